@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"strings"
+)
+
+// mappingFlag collects repeated -map flags
+type mappingFlag []string
+
+func (m *mappingFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *mappingFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+func main() {
+	var mapping mappingFlag
+	apiURL := flag.String("url", getEnv("TASK_API_URL", "http://localhost:8080"), "API base URL")
+	token := flag.String("token", os.Getenv("TASK_API_TOKEN"), "Access token (defaults to $TASK_API_TOKEN)")
+	format := flag.String("format", "", "csv or ndjson (defaults to the file extension)")
+	dryRun := flag.Bool("dry-run", false, "Only validate the file")
+	skipInvalid := flag.Bool("skip-invalid", false, "Import the valid rows even if some are invalid")
+	projectID := flag.Int("project", 0, "Project for rows without a project_id")
+	timezone := flag.String("timezone", "", "IANA time zone for due dates without one (default UTC)")
+	flag.Var(&mapping, "map", "Rename a column as source:field (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FILE\n\nImports tasks from a CSV or NDJSON file. FILE may be - for stdin.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	if *token == "" {
+		log.Fatal("An access token is required: set -token or TASK_API_TOKEN")
+	}
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = models.ImportFormatCSV
+		case ".ndjson", ".jsonl":
+			*format = models.ImportFormatNDJSON
+		default:
+			log.Fatal("Cannot tell the format from the file name: set -format")
+		}
+	}
+
+	var file io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open file: %v", err)
+		}
+		defer f.Close()
+		file = f
+	}
+
+	query := url.Values{}
+	query.Set("format", *format)
+	if *dryRun {
+		query.Set("dry_run", "true")
+	}
+	if *skipInvalid {
+		query.Set("skip_invalid", "true")
+	}
+	if *projectID != 0 {
+		query.Set("project_id", strconv.Itoa(*projectID))
+	}
+	if *timezone != "" {
+		query.Set("timezone", *timezone)
+	}
+	for _, entry := range mapping {
+		query.Add("map", entry)
+	}
+
+	endpoint := strings.TrimRight(*apiURL, "/") + "/api/v1/tasks/import?" + query.Encode()
+	req, err := http.NewRequest(http.MethodPost, endpoint, file)
+	if err != nil {
+		log.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+	if *format == models.ImportFormatCSV {
+		req.Header.Set("Content-Type", "text/csv")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("Import request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalf("Failed to read response: %v", err)
+	}
+
+	var report models.TaskImportReport
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
+		log.Fatalf("Import failed (%s): %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		log.Fatalf("Failed to decode import report: %v", err)
+	}
+
+	printReport(report, resp.StatusCode)
+	if report.Invalid > 0 || report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printReport writes the summary followed by one line per problem
+func printReport(report models.TaskImportReport, status int) {
+	switch {
+	case report.DryRun:
+		fmt.Println("Dry run: nothing was imported")
+	case status == http.StatusUnprocessableEntity:
+		fmt.Println("Nothing was imported because some rows are invalid (use -skip-invalid to import the rest)")
+	}
+	fmt.Printf("Rows: %d, valid: %d, invalid: %d, inserted: %d, failed: %d\n",
+		report.Rows, report.Valid, report.Invalid, report.Inserted, report.Failed)
+	if len(report.IgnoredColumns) > 0 {
+		fmt.Printf("Ignored columns: %s\n", strings.Join(report.IgnoredColumns, ", "))
+	}
+
+	for _, e := range report.Errors {
+		if e.Field != "" {
+			fmt.Printf("line %d: %s: %s\n", e.Line, e.Field, e.Error)
+		} else {
+			fmt.Printf("line %d: %s\n", e.Line, e.Error)
+		}
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -9,10 +9,16 @@ import (
 	"os"
 	"os/signal"
 	"scalable-task-api/internal/auth"
+	"scalable-task-api/internal/authz"
 	"scalable-task-api/internal/config"
 	"scalable-task-api/internal/handlers"
 	"scalable-task-api/internal/middleware"
 	"scalable-task-api/internal/monitoring"
+	"scalable-task-api/internal/recurrence"
+	"scalable-task-api/internal/snapshot"
+	"scalable-task-api/internal/storage"
+	"scalable-task-api/internal/stream"
+	"scalable-task-api/internal/webhook"
 	"syscall"
 	"time"
 
@@ -22,19 +28,50 @@ import (
 
 // Server represents the HTTP server
 type Server struct {
-	config     *config.Config
-	db         *sql.DB
-	router     *gin.Engine
-	jwtService *auth.JWTService
-	metrics    *monitoring.Metrics
+	config      *config.Config
+	db          *sql.DB
+	router      *gin.Engine
+	jwtService  *auth.JWTService
+	metrics     *monitoring.Metrics
+	snapshotter *snapshot.Snapshotter
+	scheduler   *recurrence.Scheduler
+	dispatcher  *webhook.Dispatcher
+	hub         *stream.Hub
 }
 
-func NewServer(cfg *config.Config, db *sql.DB) *Server {
-	jwtService := auth.NewJWTService(&cfg.JWT)
+func NewServer(cfg *config.Config, db *sql.DB) (*Server, error) {
+	jwtService, err := auth.NewJWTService(&cfg.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	tokens := auth.NewTokenStore(db, &cfg.JWT)
+	var oidc *auth.OIDCProvider
+	if cfg.Auth.OIDC.Enabled {
+		if oidc, err = auth.NewOIDCProvider(&cfg.Auth.OIDC); err != nil {
+			return nil, fmt.Errorf("failed to configure single sign-on: %w", err)
+		}
+		if err := checkRolesExist(db, oidc.Roles()); err != nil {
+			return nil, fmt.Errorf("failed to configure single sign-on: %w", err)
+		}
+	}
 	metrics := monitoring.NewMetrics()
 
-	authHandler := handlers.NewAuthHandler(db, jwtService)
-	taskHandler := handlers.NewTaskHandler(db, metrics)
+	authorizer := authz.NewAuthorizer(db)
+	blobs := storage.NewLocalStore(cfg.Attachments.StoragePath)
+	hub := stream.NewHub(db, cfg.Database.GetDSN(), authorizer)
+
+	authHandler := handlers.NewAuthHandler(db, jwtService, tokens, oidc, &cfg.Auth)
+	taskHandler := handlers.NewTaskHandler(db, metrics, authorizer, blobs)
+	projectHandler := handlers.NewProjectHandler(db, authorizer, blobs)
+	userHandler := handlers.NewUserHandler(db, tokens)
+	commentHandler := handlers.NewCommentHandler(db, authorizer)
+	workLogHandler := handlers.NewWorkLogHandler(db, authorizer)
+	attachmentHandler := handlers.NewAttachmentHandler(db, authorizer, blobs, cfg.Attachments.MaxSize)
+	recurrenceHandler := handlers.NewRecurrenceHandler(db, authorizer)
+	webhookHandler := handlers.NewWebhookHandler(db, authorizer, cfg.Webhooks.AllowPrivateNetworks)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db, authorizer)
+	roleHandler := handlers.NewRoleHandler(db, authorizer)
+	streamHandler := handlers.NewStreamHandler(hub, authorizer, tokens)
 
 	// Set up Gin
 	if cfg.Server.Host == "0.0.0.0" {
@@ -46,6 +83,9 @@ func NewServer(cfg *config.Config, db *sql.DB) *Server {
 	router.Use(middleware.CORSMiddleware())
 	router.Use(monitoring.PrometheusMiddleware(metrics))
 
+	// Token verification keys for other services
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -63,33 +103,160 @@ func NewServer(cfg *config.Config, db *sql.DB) *Server {
 		{
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/refresh", authHandler.RefreshToken)
-			auth.GET("/me", middleware.AuthMiddleware(jwtService), authHandler.Me)
+			auth.POST("/register", authHandler.Register)
+			auth.GET("/oidc/login", authHandler.OIDCLogin)
+			auth.GET("/oidc/callback", authHandler.OIDCCallback)
+			auth.POST("/oidc/link", middleware.AuthMiddleware(jwtService, tokens, authorizer), authHandler.OIDCLink)
+			auth.POST("/logout", middleware.AuthMiddleware(jwtService, tokens, authorizer), authHandler.Logout)
+			auth.GET("/me", middleware.AuthMiddleware(jwtService, tokens, authorizer), authHandler.Me)
+			auth.PUT("/me", middleware.AuthMiddleware(jwtService, tokens, authorizer), authHandler.UpdateMe)
 		}
 
+		// Task change stream, which browsers can only authenticate through the query
+		v1.GET("/stream", middleware.StreamAuthMiddleware(jwtService, tokens, authorizer), streamHandler.Stream)
+
 		// Protected routes
 		protected := v1.Group("/")
-		protected.Use(middleware.AuthMiddleware(jwtService))
+		protected.Use(middleware.AuthMiddleware(jwtService, tokens, authorizer))
 		{
 			// Task routes
 			tasks := protected.Group("/tasks")
 			{
 				tasks.POST("", taskHandler.CreateTask)
+				tasks.POST("/bulk", taskHandler.BulkTasks)
+				tasks.POST("/import", taskHandler.ImportTasks)
 				tasks.GET("", taskHandler.GetTasks)
+				tasks.GET("/export", taskHandler.ExportTasks)
 				tasks.GET("/:id", taskHandler.GetTask)
 				tasks.PUT("/:id", taskHandler.UpdateTask)
 				tasks.DELETE("/:id", taskHandler.DeleteTask)
-				tasks.GET("/metrics", taskHandler.GetTaskMetrics)
+				tasks.GET("/:id/history", taskHandler.GetTaskHistory)
+				tasks.GET("/:id/subtasks", taskHandler.GetSubtasks)
+				tasks.GET("/:id/tree", taskHandler.GetTaskTree)
+				tasks.GET("/:id/comments", commentHandler.GetComments)
+				tasks.POST("/:id/comments", commentHandler.CreateComment)
+				tasks.PUT("/:id/comments/:comment_id", commentHandler.UpdateComment)
+				tasks.DELETE("/:id/comments/:comment_id", commentHandler.DeleteComment)
+				tasks.GET("/:id/comments/:comment_id/history", commentHandler.GetCommentHistory)
+				tasks.GET("/:id/worklogs", workLogHandler.GetTaskWorkLogs)
+				tasks.POST("/:id/worklogs", workLogHandler.CreateWorkLog)
+				tasks.POST("/:id/worklogs/timer", workLogHandler.StartTimer)
+				tasks.GET("/:id/attachments", attachmentHandler.GetAttachments)
+				tasks.POST("/:id/attachments", attachmentHandler.UploadAttachment)
+				tasks.GET("/:id/attachments/:attachment_id", attachmentHandler.DownloadAttachment)
+				tasks.DELETE("/:id/attachments/:attachment_id", attachmentHandler.DeleteAttachment)
+				tasks.GET("/:id/recurrence", recurrenceHandler.GetRecurrence)
+				tasks.PUT("/:id/recurrence", recurrenceHandler.SetRecurrence)
+				tasks.DELETE("/:id/recurrence", recurrenceHandler.DeleteRecurrence)
+				tasks.GET("/:id/occurrences", recurrenceHandler.GetOccurrences)
+				tasks.GET("/:id/dependencies", taskHandler.GetTaskDependencies)
+				tasks.POST("/:id/dependencies", taskHandler.AddTaskDependency)
+				tasks.DELETE("/:id/dependencies/:blocker_id", taskHandler.RemoveTaskDependency)
+				metrics := tasks.Group("/metrics", middleware.RequirePermission(authorizer, authz.PermMetricsRead, middleware.ProjectQuery("project_id")))
+				metrics.GET("", taskHandler.GetTaskMetrics)
+				metrics.GET("/snapshots", taskHandler.GetMetricSnapshots)
+			}
+
+			// Work log routes
+			worklogs := protected.Group("/worklogs")
+			{
+				worklogs.GET("/timesheet", workLogHandler.GetTimesheet)
+				worklogs.GET("/timer", workLogHandler.GetRunningTimer)
+				worklogs.POST("/timer/stop", workLogHandler.StopTimer)
+				worklogs.PUT("/:id", workLogHandler.UpdateWorkLog)
+				worklogs.DELETE("/:id", workLogHandler.DeleteWorkLog)
+			}
+
+			// Webhook routes
+			webhooks := protected.Group("/webhooks")
+			{
+				webhooks.GET("", webhookHandler.GetWebhooks)
+				webhooks.POST("", webhookHandler.CreateWebhook)
+				webhooks.GET("/:id", webhookHandler.GetWebhook)
+				webhooks.PUT("/:id", webhookHandler.UpdateWebhook)
+				webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+				webhooks.GET("/:id/deliveries", webhookHandler.GetWebhookDeliveries)
+				webhooks.POST("/:id/deliveries/:delivery_id/redeliver", webhookHandler.RedeliverWebhookDelivery)
+			}
+
+			// API key routes
+			apiKeys := protected.Group("/api-keys")
+			{
+				apiKeys.GET("", apiKeyHandler.GetAPIKeys)
+				apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+				apiKeys.GET("/:id", apiKeyHandler.GetAPIKey)
+				apiKeys.PUT("/:id", apiKeyHandler.UpdateAPIKey)
+				apiKeys.DELETE("/:id", apiKeyHandler.DeleteAPIKey)
+			}
+
+			// Project routes
+			projects := protected.Group("/projects")
+			{
+				projects.POST("", middleware.RequirePermission(authorizer, authz.PermProjectCreate, nil), projectHandler.CreateProject)
+				projects.GET("", projectHandler.GetProjects)
+				projects.GET("/:id", projectHandler.GetProject)
+				projects.PUT("/:id", projectHandler.UpdateProject)
+				projects.DELETE("/:id", projectHandler.DeleteProject)
+				projects.GET("/:id/members", projectHandler.GetProjectMembers)
+				projects.POST("/:id/members", projectHandler.AddProjectMember)
+				projects.DELETE("/:id/members/:user_id", projectHandler.RemoveProjectMember)
+				projects.GET("/:id/workflow", projectHandler.GetWorkflow)
+				projects.PUT("/:id/workflow", projectHandler.UpdateWorkflow)
+			}
+
+			// User routes
+			users := protected.Group("/users")
+			{
+				users.GET("/directory", userHandler.SearchDirectory)
+
+				admin := users.Group("", middleware.RequirePermission(authorizer, authz.PermUserAdmin, nil))
+				admin.POST("", userHandler.CreateUser)
+				admin.GET("", userHandler.GetUsers)
+				admin.GET("/:id", userHandler.GetUser)
+				admin.PUT("/:id", userHandler.UpdateUser)
+				admin.DELETE("/:id", userHandler.DeleteUser)
+			}
+
+			// Role routes
+			protected.GET("/permissions", roleHandler.GetPermissions)
+			roles := protected.Group("/roles")
+			{
+				roles.GET("", roleHandler.GetRoles)
+				roles.GET("/:name", roleHandler.GetRole)
+
+				admin := roles.Group("", middleware.RequirePermission(authorizer, authz.PermRoleAdmin, nil))
+				admin.POST("", roleHandler.CreateRole)
+				admin.PUT("/:name", roleHandler.UpdateRole)
+				admin.DELETE("/:name", roleHandler.DeleteRole)
 			}
 		}
 	}
 
 	return &Server{
-		config:     cfg,
-		db:         db,
-		router:     router,
-		jwtService: jwtService,
-		metrics:    metrics,
+		config:      cfg,
+		db:          db,
+		router:      router,
+		jwtService:  jwtService,
+		metrics:     metrics,
+		snapshotter: snapshot.NewSnapshotter(db, &cfg.Snapshot),
+		scheduler:   recurrence.NewScheduler(db, taskHandler, &cfg.Recurrence),
+		dispatcher:  webhook.NewDispatcher(db, &cfg.Webhooks),
+		hub:         hub,
+	}, nil
+}
+
+// checkRolesExist checks that every named role is defined
+func checkRolesExist(db *sql.DB, roles []string) error {
+	for _, role := range roles {
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, role).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("role %q does not exist", role)
+		}
 	}
+	return nil
 }
 
 func (s *Server) Start() error {
@@ -97,6 +264,21 @@ func (s *Server) Start() error {
 		go s.startMetricsServer()
 	}
 
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	go s.hub.Run(workerCtx)
+	if s.config.Snapshot.Enabled {
+		go s.snapshotter.Run(workerCtx)
+	}
+	if s.config.Recurrence.Enabled {
+		go s.scheduler.Run(workerCtx)
+	}
+	if s.config.Webhooks.Enabled {
+		go s.dispatcher.Run(workerCtx)
+	}
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port),
 		Handler:      s.router,
@@ -117,6 +299,7 @@ func (s *Server) Start() error {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
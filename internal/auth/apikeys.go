@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs and
+// makes them easy to find with secret scanners
+const APIKeyPrefix = "tsk_"
+
+// apiKeyHintLength is how much of a key is kept in the clear to identify it
+const apiKeyHintLength = len(APIKeyPrefix) + 8
+
+// ErrInvalidAPIKey is returned for API keys that are unknown or expired
+var ErrInvalidAPIKey = errors.New("auth: invalid API key")
+
+// APIKeyPrincipal is the user an API key acts as and what the key allows
+type APIKeyPrincipal struct {
+	KeyID      int
+	UserID     int
+	Username   string
+	Role       string
+	ProjectIDs []int
+	Permission string
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// NewAPIKey returns a new random API key, the hash to store it by and the
+// prefix to show it by
+func NewAPIKey() (key, hash, prefix string, err error) {
+	random, err := randomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + random
+	return key, hashToken(key), key[:apiKeyHintLength], nil
+}
+
+// AuthenticateAPIKey looks up an API key and records that it was used. The
+// last-used time is only written once a minute per key.
+func (s *TokenStore) AuthenticateAPIKey(key string) (*APIKeyPrincipal, error) {
+	var principal APIKeyPrincipal
+	var projectIDs pq.Int64Array
+	err := s.db.QueryRow(`
+		SELECT k.id, k.user_id, u.username, COALESCE(u.role, 'user'), k.project_ids, k.permission
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND (k.expires_at IS NULL OR k.expires_at > NOW())
+	`, hashToken(key)).Scan(
+		&principal.KeyID, &principal.UserID, &principal.Username, &principal.Role, &projectIDs, &principal.Permission,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range projectIDs {
+		principal.ProjectIDs = append(principal.ProjectIDs, int(id))
+	}
+
+	if _, err := s.db.Exec(`
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, principal.KeyID); err != nil {
+		return nil, err
+	}
+
+	return &principal, nil
+}
+
+// APIKeyRole returns the current role of the user an API key acts as, or
+// ErrInvalidAPIKey once the key has been deleted or has expired
+func (s *TokenStore) APIKeyRole(keyID int) (string, error) {
+	var role string
+	err := s.db.QueryRow(`
+		SELECT COALESCE(u.role, 'user')
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.id = $1 AND (k.expires_at IS NULL OR k.expires_at > NOW())
+	`, keyID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidAPIKey
+	}
+	return role, err
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 	"scalable-task-api/internal/config"
@@ -9,82 +10,191 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenUseAccess is the token_use of access tokens. Tokens with any other
+// use are not accepted for API requests.
+const TokenUseAccess = "access"
+
+// issuer is the iss claim of every token
+const issuer = "scalable-task-api"
+
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
-	Role     string `json:"role"`
+	// Role is the user's role when the token was issued, for other services.
+	// This API reads the current role on every request instead.
+	Role string `json:"role"`
+	// SessionID is the family of the refresh token the access token was
+	// issued with, so revoking the session also revokes its access tokens
+	SessionID string `json:"sid,omitempty"`
+	// TokenUse says what the token may be used for
+	TokenUse string `json:"token_use"`
 	jwt.RegisteredClaims
 }
 
+// JWTService issues and verifies tokens. With HS256 they are signed with the
+// shared secret; with RS256 or EdDSA they are signed with the private key and
+// carry its kid, and any configured public key is accepted by kid, so keys
+// can be rotated without invalidating tokens already issued.
 type JWTService struct {
-	config *config.JWTConfig
+	config     *config.JWTConfig
+	method     jwt.SigningMethod
+	signKey    interface{}
+	keyID      string
+	verifyKeys map[string]verifyKey
+	jwks       JWKSet
 }
 
-// NewJWTService creates a new JWT service
-func NewJWTService(cfg *config.JWTConfig) *JWTService {
-	return &JWTService{
-		config: cfg,
+// NewJWTService creates a new JWT service, loading the configured keys
+func NewJWTService(cfg *config.JWTConfig) (*JWTService, error) {
+	j := &JWTService{
+		config:     cfg,
+		verifyKeys: map[string]verifyKey{},
+		jwks:       JWKSet{Keys: []JWK{}},
+	}
+
+	switch cfg.Algorithm {
+	case "", jwt.SigningMethodHS256.Alg():
+		j.method = jwt.SigningMethodHS256
+		j.signKey = []byte(cfg.SecretKey)
+		return j, nil
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %s", cfg.Algorithm)
+	}
+
+	if cfg.PrivateKeyFile == "" {
+		return nil, fmt.Errorf("a private key file is required for %s", cfg.Algorithm)
+	}
+	signer, err := loadPrivateKey(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	method, err := signingMethodFor(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	if method.Alg() != cfg.Algorithm {
+		return nil, fmt.Errorf("%s is a key for %s, not %s", cfg.PrivateKeyFile, method.Alg(), cfg.Algorithm)
+	}
+	j.method = method
+	j.signKey = signer
+	if j.keyID, err = j.addVerifyKey(signer.Public()); err != nil {
+		return nil, err
 	}
+
+	for _, path := range cfg.PublicKeyFiles {
+		key, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := j.addVerifyKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return j, nil
 }
 
-// GenerateToken generates a new JWT token
-func (j *JWTService) GenerateToken(userID int, username, role string) (string, error) {
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.config.TokenExpiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "scalable-task-api",
-			Subject:   fmt.Sprintf("user-%d", userID),
-		},
+// addVerifyKey accepts tokens signed with key and publishes it, returning
+// its kid
+func (j *JWTService) addVerifyKey(key crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := j.verifyKeys[jwk.Kid]; ok {
+		return jwk.Kid, nil
+	}
+
+	method, err := signingMethodFor(key)
+	if err != nil {
+		return "", err
 	}
+	j.verifyKeys[jwk.Kid] = verifyKey{method: method, key: key}
+	j.jwks.Keys = append(j.jwks.Keys, jwk)
+	return jwk.Kid, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.config.SecretKey))
+// JWKS returns the public keys tokens may be signed with. It is empty with
+// HS256, whose tokens can only be verified with the shared secret.
+func (j *JWTService) JWKS() JWKSet {
+	return j.jwks
 }
 
-func (j *JWTService) GenerateRefreshToken(userID int, username, role string) (string, error) {
+// GenerateToken generates a new JWT access token for a session. Each token
+// gets a unique ID (jti) so it can be revoked on its own.
+func (j *JWTService) GenerateToken(userID int, username, role, sessionID string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
+		TokenUse:  TokenUseAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.config.RefreshExpiration)),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.config.TokenExpiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "scalable-task-api",
+			Issuer:    issuer,
 			Subject:   fmt.Sprintf("user-%d", userID),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.config.SecretKey))
+	token := jwt.NewWithClaims(j.method, claims)
+	if j.keyID != "" {
+		token.Header["kid"] = j.keyID
+	}
+	return token.SignedString(j.signKey)
 }
 
-func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(j.config.SecretKey), nil
-	})
+// ValidateAccessToken verifies a token's signature, expiry and issuer and
+// that it is an access token
+func (j *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
+	methods := []string{jwt.SigningMethodHS256.Alg()}
+	if j.keyID != "" {
+		methods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+	}
 
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, j.keyFunc,
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(issuer),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		// Check if token is expired
-		if claims.ExpiresAt.Before(time.Now()) {
-			return nil, errors.New("token is expired")
-		}
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
+	if claims.TokenUse != TokenUseAccess {
+		return nil, fmt.Errorf("token_use is %q, not %q", claims.TokenUse, TokenUseAccess)
+	}
+	return claims, nil
+}
 
-	return nil, errors.New("invalid token")
+// keyFunc returns the key a token must be signed with: the shared secret
+// with HS256, otherwise the public key named by its kid
+func (j *JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if j.keyID == "" {
+		return j.signKey, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := j.verifyKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID: %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method for key %s: %v", kid, token.Header["alg"])
+	}
+	return key.key, nil
 }
 
 // TokenResponse represents the response for token generation
@@ -102,4 +212,10 @@ type LoginRequest struct {
 
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest represents the optional request payload for logging out. With
+// All set, every session of the user is ended rather than only the current one.
+type LogoutRequest struct {
+	All bool `json:"all"`
 }
\ No newline at end of file
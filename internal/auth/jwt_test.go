@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"scalable-task-api/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey writes a PKCS #8 private key to a PEM file in the test's directory
+func writeKey(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newTestService(t *testing.T, cfg config.JWTConfig) *JWTService {
+	t.Helper()
+	cfg.TokenExpiration = time.Hour
+	svc, err := NewJWTService(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+// sign signs claims the way GenerateToken does, with any kid
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims *Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// claimsFor returns valid access token claims with the given token_use
+func claimsFor(use string) *Claims {
+	now := time.Now()
+	return &Claims{
+		UserID:   1,
+		Username: "alice",
+		TokenUse: use,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    issuer,
+		},
+	}
+}
+
+func TestValidateAccessToken(t *testing.T) {
+	const secret = "test-secret"
+	hs := newTestService(t, config.JWTConfig{SecretKey: secret})
+
+	signingKey, otherKey := newRSAKey(t), newRSAKey(t)
+	rs := newTestService(t, config.JWTConfig{Algorithm: "RS256", PrivateKeyFile: writeKey(t, signingKey)})
+	otherKid, err := publicJWK(otherKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := hs.GenerateToken(1, "alice", "user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsAccess, err := rs.GenerateToken(1, "alice", "user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := claimsFor(TokenUseAccess)
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	otherIssuer := claimsFor(TokenUseAccess)
+	otherIssuer.Issuer = "someone-else"
+
+	tests := []struct {
+		name  string
+		svc   *JWTService
+		token string
+		valid bool
+	}{
+		{"HS256 access token", hs, access, true},
+		{"RS256 access token", rs, rsAccess, true},
+		{"opaque refresh token", hs, refresh, false},
+		{"refresh token_use", hs, sign(t, jwt.SigningMethodHS256, []byte(secret), "", claimsFor("refresh")), false},
+		{"missing token_use", hs, sign(t, jwt.SigningMethodHS256, []byte(secret), "", claimsFor("")), false},
+		{"expired", hs, sign(t, jwt.SigningMethodHS256, []byte(secret), "", expired), false},
+		{"other issuer", hs, sign(t, jwt.SigningMethodHS256, []byte(secret), "", otherIssuer), false},
+		{"wrong secret", hs, sign(t, jwt.SigningMethodHS256, []byte("other"), "", claimsFor(TokenUseAccess)), false},
+		{"unknown kid", rs, sign(t, jwt.SigningMethodRS256, otherKey, otherKid.Kid, claimsFor(TokenUseAccess)), false},
+		{"missing kid", rs, sign(t, jwt.SigningMethodRS256, signingKey, "", claimsFor(TokenUseAccess)), false},
+		{"known kid signed with another key", rs, sign(t, jwt.SigningMethodRS256, otherKey, rs.keyID, claimsFor(TokenUseAccess)), false},
+		{"refresh token_use with RS256", rs, sign(t, jwt.SigningMethodRS256, signingKey, rs.keyID, claimsFor("refresh")), false},
+		{"HS256 token for an RS256 service", rs, sign(t, jwt.SigningMethodHS256, []byte(secret), rs.keyID, claimsFor(TokenUseAccess)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.svc.ValidateAccessToken(tt.token)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("ValidateAccessToken failed: %v", err)
+				}
+				if claims.UserID != 1 || claims.TokenUse != TokenUseAccess {
+					t.Fatalf("unexpected claims %+v", claims)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("ValidateAccessToken accepted the token")
+			}
+		})
+	}
+}
+
+func TestRotateRefreshTokenRejectsAccessToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	svc := newTestService(t, config.JWTConfig{SecretKey: "test-secret"})
+	access, err := svc.GenerateToken(1, "alice", "user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refresh tokens are looked up by hash, which no access token matches
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, family_id, user_id, expires_at, used_at, revoked_at").
+		WithArgs(hashToken(access)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	store := NewTokenStore(db, &config.JWTConfig{RefreshExpiration: time.Hour})
+	if _, err := store.RotateRefreshToken(access); err != ErrInvalidRefreshToken {
+		t.Fatalf("RotateRefreshToken returned %v, want ErrInvalidRefreshToken", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSRoundTrip(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		alg  string
+		key  crypto.Signer
+	}{
+		{"RSA", "RS256", newRSAKey(t)},
+		{"Ed25519", "EdDSA", edKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, config.JWTConfig{Algorithm: tt.alg, PrivateKeyFile: writeKey(t, tt.key)})
+
+			// Decode the document as a client fetching it would
+			data, err := json.Marshal(svc.JWKS())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var set JWKSet
+			if err := json.Unmarshal(data, &set); err != nil {
+				t.Fatal(err)
+			}
+			if len(set.Keys) != 1 {
+				t.Fatalf("JWKS has %d keys, want 1", len(set.Keys))
+			}
+			jwk := set.Keys[0]
+			if jwk.Kid != svc.keyID || jwk.Alg != tt.alg || jwk.Use != "sig" {
+				t.Fatalf("unexpected JWK %+v", jwk)
+			}
+
+			public, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !public.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.key.Public()) {
+				t.Fatal("decoded key differs from the signing key")
+			}
+
+			// A token the service issued verifies with the published key
+			access, err := svc.GenerateToken(1, "alice", "user", "session")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jwt.Parse(access, func(*jwt.Token) (interface{}, error) { return public, nil }); err != nil {
+				t.Fatalf("token does not verify with the published key: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"scalable-task-api/internal/config"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrOIDCRejected is returned when the identity provider refuses a login or
+// its ID token does not check out, as opposed to it being unreachable
+var ErrOIDCRejected = errors.New("auth: identity provider rejected the login")
+
+// oidcKeysRefreshInterval is how often the provider's keys may be refetched
+// to find a key ID that is not known yet
+const oidcKeysRefreshInterval = time.Minute
+
+// OIDCLogin is an authorization request in progress. Its state is sent to the
+// provider and returned with the code; the nonce and code verifier must be
+// kept until then to finish the login.
+type OIDCLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// OIDCIdentity is the user the identity provider signed in
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+	Groups        []string
+}
+
+// oidcDiscovery is the part of the provider's discovery document we use
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// roleMapping gives the members of a group a role
+type roleMapping struct {
+	group string
+	role  string
+}
+
+// OIDCProvider signs users in with an OpenID Connect provider through the
+// authorization code flow with PKCE. The discovery document and signing keys
+// are fetched when first needed, so the API starts even if the provider is
+// down, and the keys are refetched when a token names an unknown key.
+type OIDCProvider struct {
+	config *config.OIDCConfig
+	client *http.Client
+	roles  []roleMapping
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]JWK
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider creates an OpenID Connect provider from its configuration
+func NewOIDCProvider(cfg *config.OIDCConfig) (*OIDCProvider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("the OIDC issuer URL, client ID and redirect URL are required")
+	}
+
+	p := &OIDCProvider{
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, mapping := range cfg.RoleMappings {
+		group, role, ok := strings.Cut(mapping, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid OIDC role mapping %q: want group=role", mapping)
+		}
+		p.roles = append(p.roles, roleMapping{group: group, role: role})
+	}
+	return p, nil
+}
+
+// NewOIDCLogin starts a login with a random state, nonce and PKCE code verifier
+func NewOIDCLogin() (*OIDCLogin, error) {
+	var login OIDCLogin
+	var err error
+	if login.State, err = randomToken(24); err != nil {
+		return nil, err
+	}
+	if login.Nonce, err = randomToken(24); err != nil {
+		return nil, err
+	}
+	if login.CodeVerifier, err = randomToken(32); err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+// AuthCodeURL returns the provider URL to send the user to for a login
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, login *OIDCLogin) (string, error) {
+	discovery, err := p.provider(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	if authURL.RawQuery != "" {
+		authURL.RawQuery += "&"
+	}
+	authURL.RawQuery += query.Encode()
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code for the login and returns the
+// identity in the verified ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, login *OIDCLogin) (*OIDCIdentity, error) {
+	discovery, err := p.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {login.CodeVerifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("invalid token response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrOIDCRejected, token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed: HTTP %d", resp.StatusCode)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in the token response", ErrOIDCRejected)
+	}
+
+	return p.verifyIDToken(ctx, discovery, token.IDToken, login.Nonce)
+}
+
+// Role returns the role for a user's groups: that of the first role mapping
+// naming one of them, or the default role
+func (p *OIDCProvider) Role(groups []string) string {
+	for _, mapping := range p.roles {
+		for _, group := range groups {
+			if group == mapping.group {
+				return mapping.role
+			}
+		}
+	}
+	return p.config.DefaultRole
+}
+
+// Roles returns every role Role may return, so they can be checked to exist
+func (p *OIDCProvider) Roles() []string {
+	roles := []string{p.config.DefaultRole}
+	for _, mapping := range p.roles {
+		roles = append(roles, mapping.role)
+	}
+	return roles
+}
+
+// verifyIDToken checks an ID token's signature, issuer, audience, expiry and
+// nonce and returns the identity it carries
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, raw, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, p.keyFunc(ctx),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ID token: %v", ErrOIDCRejected, err)
+	}
+
+	if azp, ok := claims["azp"].(string); ok && azp != p.config.ClientID {
+		return nil, fmt.Errorf("%w: ID token was issued to %q", ErrOIDCRejected, azp)
+	}
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: ID token nonce does not match", ErrOIDCRejected)
+	}
+
+	identity := &OIDCIdentity{Issuer: discovery.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: ID token has no subject", ErrOIDCRejected)
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.Username, _ = claims["preferred_username"].(string)
+	identity.Name, _ = claims["name"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	identity.Groups = claimStrings(claims, p.config.GroupsClaim)
+
+	return identity, nil
+}
+
+// claimStrings returns a claim holding a string or a list of strings. Dots
+// in the path address claims nested in objects.
+func claimStrings(claims map[string]interface{}, path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// keyFunc returns the provider key an ID token names, refetching the
+// provider's keys if it is not known yet
+func (p *OIDCProvider) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		jwk, ok := p.findKey(kid, token.Method.Alg())
+		if !ok && time.Since(p.keysFetchedAt) >= oidcKeysRefreshInterval {
+			if err := p.fetchKeys(ctx); err != nil {
+				return nil, err
+			}
+			jwk, ok = p.findKey(kid, token.Method.Alg())
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID: %q", kid)
+		}
+		if jwk.Alg != "" && jwk.Alg != token.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method for key %s: %v", kid, token.Header["alg"])
+		}
+		return jwk.PublicKey()
+	}
+}
+
+// findKey returns the key with a key ID. Tokens without one may use the
+// provider's only key for their algorithm. The caller must hold p.mu.
+func (p *OIDCProvider) findKey(kid, alg string) (JWK, bool) {
+	if kid != "" {
+		jwk, ok := p.keys[kid]
+		return jwk, ok
+	}
+
+	var found []JWK
+	for _, jwk := range p.keys {
+		if jwk.Alg == "" || jwk.Alg == alg {
+			found = append(found, jwk)
+		}
+	}
+	if len(found) != 1 {
+		return JWK{}, false
+	}
+	return found[0], true
+}
+
+// fetchKeys replaces the provider's signing keys. The caller must hold p.mu.
+func (p *OIDCProvider) fetchKeys(ctx context.Context) error {
+	if p.discovery == nil {
+		return errors.New("provider has not been discovered")
+	}
+
+	var set JWKSet
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &set); err != nil {
+		return fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+
+	keys := map[string]JWK{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		keys[jwk.Kid] = jwk
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	return nil
+}
+
+// provider returns the provider's discovery document, fetching it and its
+// keys on first use
+func (p *OIDCProvider) provider(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	discoveryURL := strings.TrimSuffix(p.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if discovery.Issuer != p.config.IssuerURL {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer is %q, not %q", discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery failed: the authorization, token and JWKS endpoints are required")
+	}
+
+	p.discovery = &discovery
+	if err := p.fetchKeys(ctx); err != nil {
+		p.discovery = nil
+		return nil, err
+	}
+	return p.discovery, nil
+}
+
+// getJSON fetches a JSON document
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
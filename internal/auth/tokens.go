@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"scalable-task-api/internal/config"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for refresh tokens that are unknown,
+	// expired or revoked
+	ErrInvalidRefreshToken = errors.New("auth: invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already
+	// rotated is presented again. Its whole family has been revoked.
+	ErrRefreshTokenReused = errors.New("auth: refresh token reused")
+	// ErrAccessTokenRevoked is returned for access tokens that were revoked,
+	// or whose user was deleted
+	ErrAccessTokenRevoked = errors.New("auth: access token revoked")
+)
+
+// RefreshToken is a newly issued refresh token. FamilyID identifies the login
+// session it belongs to and is carried by that session's access tokens.
+type RefreshToken struct {
+	Token    string
+	FamilyID string
+	UserID   int
+}
+
+// TokenStore keeps refresh tokens and revoked access tokens in Postgres.
+// Refresh tokens are opaque random strings stored only as hashes; each use
+// replaces the token with a new one in the same family, and presenting a
+// replaced token again revokes the family.
+type TokenStore struct {
+	db                *sql.DB
+	refreshExpiration time.Duration
+}
+
+// NewTokenStore creates a new token store
+func NewTokenStore(db *sql.DB, cfg *config.JWTConfig) *TokenStore {
+	return &TokenStore{
+		db:                db,
+		refreshExpiration: cfg.RefreshExpiration,
+	}
+}
+
+// IssueRefreshToken starts a new session for the user
+func (s *TokenStore) IssueRefreshToken(userID int) (RefreshToken, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return s.insertRefreshToken(s.db, userID, familyID)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same
+// family. The presented token cannot be used again.
+func (s *TokenStore) RotateRefreshToken(token string) (RefreshToken, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var familyID string
+	var userID int
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, family_id, user_id, expires_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(token)).Scan(&id, &familyID, &userID, &expiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return RefreshToken{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	if revokedAt.Valid || expiresAt.Before(time.Now()) {
+		return RefreshToken{}, ErrInvalidRefreshToken
+	}
+
+	// A replaced token should only ever be held by the client it was issued
+	// to, so seeing it again means it leaked. Either party may be the
+	// attacker, so the whole session is ended.
+	if usedAt.Valid {
+		if _, err := tx.Exec(`
+			UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL
+		`, familyID); err != nil {
+			return RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return RefreshToken{}, err
+		}
+		return RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, id); err != nil {
+		return RefreshToken{}, err
+	}
+
+	next, err := s.insertRefreshToken(tx, userID, familyID)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return next, tx.Commit()
+}
+
+// RevokeFamily ends a session of the user
+func (s *TokenStore) RevokeFamily(userID int, familyID string) error {
+	_, err := s.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, familyID, userID)
+	return err
+}
+
+// RevokeUser ends every session of the user
+func (s *TokenStore) RevokeUser(userID int) error {
+	_, err := s.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
+
+// RevokeAccessToken adds an access token to the denylist until it expires.
+// Expired entries are removed along the way.
+func (s *TokenStore) RevokeAccessToken(claims *Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	if _, err := s.db.Exec(`
+		INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`DELETE FROM revoked_tokens WHERE expires_at < NOW()`)
+	return err
+}
+
+// CurrentRole checks that an access token is still valid and returns its
+// user's current global role, so role changes apply to tokens already issued.
+// Tokens revoked on their own or with their session, and tokens of users who
+// no longer exist, yield ErrAccessTokenRevoked.
+func (s *TokenStore) CurrentRole(claims *Claims) (string, error) {
+	var role string
+	var revoked bool
+	err := s.db.QueryRow(`
+		SELECT COALESCE(u.role, 'user'),
+			EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $2)
+				OR EXISTS (SELECT 1 FROM refresh_tokens WHERE family_id = $3 AND revoked_at IS NOT NULL)
+		FROM users u
+		WHERE u.id = $1
+	`, claims.UserID, claims.ID, claims.SessionID).Scan(&role, &revoked)
+	if err == sql.ErrNoRows || err == nil && revoked {
+		return "", ErrAccessTokenRevoked
+	}
+	return role, err
+}
+
+type execQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *TokenStore) insertRefreshToken(db execQuerier, userID int, familyID string) (RefreshToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	// Expired tokens of the user are removed along the way
+	if _, err := db.Exec(`
+		DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at < NOW()
+	`, userID); err != nil {
+		return RefreshToken{}, err
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, hashToken(token), familyID, userID, time.Now().Add(s.refreshExpiration)); err != nil {
+		return RefreshToken{}, err
+	}
+
+	return RefreshToken{Token: token, FamilyID: familyID, UserID: userID}, nil
+}
+
+// randomToken returns n random bytes, URL-safe base64 encoded
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token. Tokens are random, so a fast
+// hash is enough to keep a database leak from exposing usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
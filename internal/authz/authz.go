@@ -0,0 +1,265 @@
+package authz
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrNotFound is returned when a resource does not exist or is not visible to the caller
+	ErrNotFound = errors.New("authz: resource not found")
+	// ErrForbidden is returned when a resource is visible but the caller lacks the required access
+	ErrForbidden = errors.New("authz: insufficient access")
+)
+
+// Access is a caller's level of access to a project
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessRead
+	AccessWrite
+	AccessOwner
+)
+
+// Querier runs the authorization lookups. It is implemented by both *sql.DB
+// and *sql.Tx, so checks can see rows written earlier in a transaction.
+type Querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// MemberRoleMember is the role project members get by default
+const MemberRoleMember = "member"
+
+// Subject identifies the caller an authorization decision is made for
+type Subject struct {
+	UserID int
+	Role   string
+	// Permissions are those granted by the subject's global role
+	Permissions PermissionSet
+	// Scope is set when the caller authenticated with an API key
+	Scope *Scope
+}
+
+// Scope limits a subject to some projects and to at most read or write
+// access. An empty ProjectIDs allows every project the user can access.
+type Scope struct {
+	ProjectIDs []int
+	Access     Access
+}
+
+// InScope reports whether the subject's scope allows a project
+func (s Subject) InScope(projectID int) bool {
+	if s.Scope == nil || len(s.Scope.ProjectIDs) == 0 {
+		return true
+	}
+	for _, id := range s.Scope.ProjectIDs {
+		if id == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the subject's global role grants every permission,
+// which lets them administer other users' resources
+func (s Subject) IsAdmin() bool {
+	return s.Permissions.Has(PermAll)
+}
+
+// SubjectFromContext reads the subject that AuthMiddleware stored in the gin context
+func SubjectFromContext(c *gin.Context) (Subject, bool) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return Subject{}, false
+	}
+	id, ok := userID.(int)
+	if !ok {
+		return Subject{}, false
+	}
+	scope, _ := c.Value("scope").(*Scope)
+	permissions, _ := c.Value("permissions").(PermissionSet)
+	return Subject{UserID: id, Role: c.GetString("role"), Permissions: permissions, Scope: scope}, true
+}
+
+// Authorizer decides whether a subject may access projects and their tasks.
+// Project owners have full access to their projects. Other users get the
+// access the permissions of their global role grant in every project, or of
+// their member role in a project, whichever is higher.
+type Authorizer struct {
+	db    *sql.DB
+	roles roleCache
+}
+
+// NewAuthorizer creates a new authorizer
+func NewAuthorizer(db *sql.DB) *Authorizer {
+	return &Authorizer{
+		db: db,
+	}
+}
+
+// ProjectAccess returns the subject's access level to a project, limited by
+// its scope. It returns ErrNotFound when the project does not exist.
+func (a *Authorizer) ProjectAccess(s Subject, projectID int) (Access, error) {
+	return a.projectAccess(a.db, s, projectID)
+}
+
+func (a *Authorizer) projectAccess(q Querier, s Subject, projectID int) (Access, error) {
+	access, err := a.userProjectAccess(q, s, projectID)
+	if err != nil || s.Scope == nil {
+		return access, err
+	}
+	if !s.InScope(projectID) {
+		return AccessNone, nil
+	}
+	if access > s.Scope.Access {
+		access = s.Scope.Access
+	}
+	return access, nil
+}
+
+// userProjectAccess returns the access the subject's user has to a project
+func (a *Authorizer) userProjectAccess(q Querier, s Subject, projectID int) (Access, error) {
+	var ownerID sql.NullInt64
+	var memberRole sql.NullString
+	err := q.QueryRow(`
+		SELECT p.owner_id, m.role
+		FROM projects p
+		LEFT JOIN project_members m ON m.project_id = p.id AND m.user_id = $2
+		WHERE p.id = $1
+	`, projectID, s.UserID).Scan(&ownerID, &memberRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AccessNone, ErrNotFound
+		}
+		return AccessNone, err
+	}
+
+	if ownerID.Valid && int(ownerID.Int64) == s.UserID {
+		return AccessOwner, nil
+	}
+
+	access := s.Permissions.Access()
+	if memberRole.Valid {
+		permissions, err := a.RolePermissions(memberRole.String)
+		if err != nil {
+			return AccessNone, err
+		}
+		if permissions.Access() > access {
+			access = permissions.Access()
+		}
+	}
+	return access, nil
+}
+
+// RequireProject checks that the subject has at least the given access to a
+// project. Projects the subject cannot see are reported as ErrNotFound so
+// their existence is not leaked; visible projects with too little access
+// yield ErrForbidden.
+func (a *Authorizer) RequireProject(s Subject, projectID int, need Access) error {
+	return a.RequireProjectIn(a.db, s, projectID, need)
+}
+
+// RequireProjectIn is RequireProject run through q, such as a transaction
+func (a *Authorizer) RequireProjectIn(q Querier, s Subject, projectID int, need Access) error {
+	access, err := a.projectAccess(q, s, projectID)
+	if err != nil {
+		return err
+	}
+	return check(access, need)
+}
+
+// RequireTask checks that the subject has at least the given access to the
+// project a task belongs to and returns that project's ID.
+func (a *Authorizer) RequireTask(s Subject, taskID int, need Access) (int, error) {
+	return a.RequireTaskIn(a.db, s, taskID, need)
+}
+
+// RequireTaskIn is RequireTask run through q, so tasks created earlier in a
+// transaction are found
+func (a *Authorizer) RequireTaskIn(q Querier, s Subject, taskID int, need Access) (int, error) {
+	var projectID int
+	err := q.QueryRow(`SELECT project_id FROM tasks WHERE id = $1`, taskID).Scan(&projectID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	access, err := a.projectAccess(q, s, projectID)
+	if err != nil {
+		return 0, err
+	}
+	return projectID, check(access, need)
+}
+
+// VisibleProjectsCondition returns an SQL predicate restricting column to the
+// projects the subject can see, along with its arguments numbered from
+// argIndex. Subjects whose global role lets them read every project get an
+// empty predicate unless their scope names projects.
+func (a *Authorizer) VisibleProjectsCondition(s Subject, column string, argIndex int) (string, []interface{}) {
+	var scopeCondition string
+	if s.Scope != nil && len(s.Scope.ProjectIDs) > 0 {
+		ids := make([]string, len(s.Scope.ProjectIDs))
+		for i, id := range s.Scope.ProjectIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		scopeCondition = column + ` = ANY('{` + strings.Join(ids, ",") + `}'::INTEGER[])`
+	}
+
+	if s.Permissions.Access() >= AccessRead {
+		return scopeCondition, nil
+	}
+	placeholder := "$" + strconv.Itoa(argIndex)
+	condition := column + ` IN (
+		SELECT id FROM projects WHERE owner_id = ` + placeholder + `
+		UNION
+		SELECT m.project_id FROM project_members m JOIN roles r ON r.name = m.role
+		WHERE m.user_id = ` + placeholder + ` AND r.permissions && ` + readPermissionsSQL + `
+	)`
+	if scopeCondition != "" {
+		condition = "(" + condition + " AND " + scopeCondition + ")"
+	}
+	return condition, []interface{}{s.UserID}
+}
+
+// ProjectReaders returns the users with at least read access to a project
+// through ownership or membership. Users whose global role lets them read
+// every project are not included.
+func (a *Authorizer) ProjectReaders(projectID int) (map[int]bool, error) {
+	rows, err := a.db.Query(`
+		SELECT owner_id FROM projects WHERE id = $1 AND owner_id IS NOT NULL
+		UNION
+		SELECT m.user_id FROM project_members m JOIN roles r ON r.name = m.role
+		WHERE m.project_id = $1 AND r.permissions && `+readPermissionsSQL+`
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readers := map[int]bool{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		readers[userID] = true
+	}
+	return readers, rows.Err()
+}
+
+func check(access, need Access) error {
+	if access == AccessNone {
+		return ErrNotFound
+	}
+	if access < need {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package authz
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Permissions roles can grant. Roles bound to a user globally grant them
+// everywhere; roles bound in a project only grant the project permissions
+// (tasks, metrics and project administration) in that project.
+const (
+	PermAll           = "*"
+	PermTaskRead      = "task:read"
+	PermTaskWrite     = "task:write"
+	PermMetricsRead   = "metrics:read"
+	PermProjectCreate = "project:create"
+	PermProjectAdmin  = "project:admin"
+	PermUserAdmin     = "user:admin"
+	PermRoleAdmin     = "role:admin"
+)
+
+// Permission describes a permission roles can grant
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AllPermissions lists every permission roles can grant
+var AllPermissions = []Permission{
+	{PermAll, "Every permission, including administering other users' resources"},
+	{PermTaskRead, "Read tasks and their comments, work logs and attachments"},
+	{PermTaskWrite, "Create, update and delete tasks and their comments, work logs and attachments"},
+	{PermMetricsRead, "Read task metrics"},
+	{PermProjectCreate, "Create projects"},
+	{PermProjectAdmin, "Update and delete projects and manage their members and workflow"},
+	{PermUserAdmin, "Create, update and delete users"},
+	{PermRoleAdmin, "Create, update and delete roles"},
+}
+
+// ValidPermission reports whether a permission exists
+func ValidPermission(name string) bool {
+	for _, permission := range AllPermissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readPermissionsSQL is the permissions granting at least read access to a
+// project, as a Postgres array literal
+const readPermissionsSQL = `'{` + PermAll + `,` + PermProjectAdmin + `,` + PermTaskWrite + `,` + PermTaskRead + `}'::TEXT[]`
+
+// rolesCacheTTL is how long role permissions are cached. Changes made through
+// this instance apply at once; other instances see them after this long.
+const rolesCacheTTL = 30 * time.Second
+
+// PermissionSet is the set of permissions a role grants
+type PermissionSet map[string]bool
+
+// Has reports whether the set grants a permission
+func (p PermissionSet) Has(permission string) bool {
+	return p[PermAll] || p[permission]
+}
+
+// Access returns the project access level the set grants
+func (p PermissionSet) Access() Access {
+	switch {
+	case p.Has(PermProjectAdmin):
+		return AccessOwner
+	case p.Has(PermTaskWrite):
+		return AccessWrite
+	case p.Has(PermTaskRead):
+		return AccessRead
+	}
+	return AccessNone
+}
+
+// roleCache holds the permissions of every role
+type roleCache struct {
+	mu       sync.Mutex
+	roles    map[string]PermissionSet
+	loadedAt time.Time
+}
+
+// RolePermissions returns the permissions a role grants. Unknown roles grant
+// none.
+func (a *Authorizer) RolePermissions(role string) (PermissionSet, error) {
+	a.roles.mu.Lock()
+	defer a.roles.mu.Unlock()
+
+	if a.roles.roles == nil || time.Since(a.roles.loadedAt) >= rolesCacheTTL {
+		roles, err := loadRoles(a.db)
+		if err != nil {
+			return nil, err
+		}
+		a.roles.roles = roles
+		a.roles.loadedAt = time.Now()
+	}
+	return a.roles.roles[role], nil
+}
+
+// InvalidateRoles drops the cached role permissions after roles change
+func (a *Authorizer) InvalidateRoles() {
+	a.roles.mu.Lock()
+	a.roles.roles = nil
+	a.roles.mu.Unlock()
+}
+
+// loadRoles reads the permissions of every role
+func loadRoles(db *sql.DB) (map[string]PermissionSet, error) {
+	rows, err := db.Query(`SELECT name, permissions FROM roles`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := map[string]PermissionSet{}
+	for rows.Next() {
+		var name string
+		var permissions []string
+		if err := rows.Scan(&name, pq.Array(&permissions)); err != nil {
+			return nil, err
+		}
+		set := PermissionSet{}
+		for _, permission := range permissions {
+			set[permission] = true
+		}
+		roles[name] = set
+	}
+	return roles, rows.Err()
+}
+
+// RequirePermission checks that the subject has a permission, through their
+// global role or, when projectID is not zero, their role in that project.
+// Project owners have every project permission in their projects. API keys
+// limited to some projects only have permissions in those projects. As with
+// RequireProject, projects the subject cannot see yield ErrNotFound.
+func (a *Authorizer) RequirePermission(s Subject, permission string, projectID int) error {
+	granted := s.Permissions.Has(permission)
+	if s.Scope != nil && len(s.Scope.ProjectIDs) > 0 {
+		granted = granted && projectID != 0 && s.InScope(projectID)
+	}
+	if granted {
+		return nil
+	}
+	if projectID == 0 {
+		return ErrForbidden
+	}
+
+	var ownerID sql.NullInt64
+	var memberRole sql.NullString
+	err := a.db.QueryRow(`
+		SELECT p.owner_id, m.role
+		FROM projects p
+		LEFT JOIN project_members m ON m.project_id = p.id AND m.user_id = $2
+		WHERE p.id = $1
+	`, projectID, s.UserID).Scan(&ownerID, &memberRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	access := s.Permissions.Access()
+	granted = ownerID.Valid && int(ownerID.Int64) == s.UserID
+	if granted {
+		access = AccessOwner
+	} else if memberRole.Valid {
+		permissions, err := a.RolePermissions(memberRole.String)
+		if err != nil {
+			return err
+		}
+		granted = permissions.Has(permission)
+		if permissions.Access() > access {
+			access = permissions.Access()
+		}
+	}
+
+	switch {
+	case access == AccessNone || !s.InScope(projectID):
+		return ErrNotFound
+	case !granted:
+		return ErrForbidden
+	}
+	return nil
+}
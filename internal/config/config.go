@@ -4,6 +4,7 @@ import (
         "fmt"
         "os"
         "strconv"
+        "strings"
         "time"
 )
 
@@ -12,7 +13,12 @@ type Config struct {
         Server   ServerConfig   `yaml:"server"`
         Database DatabaseConfig `yaml:"database"`
         JWT      JWTConfig      `yaml:"jwt"`
+        Auth     AuthConfig     `yaml:"auth"`
         Metrics  MetricsConfig  `yaml:"metrics"`
+        Snapshot SnapshotConfig `yaml:"snapshot"`
+        Attachments AttachmentsConfig `yaml:"attachments"`
+        Recurrence RecurrenceConfig `yaml:"recurrence"`
+        Webhooks WebhooksConfig `yaml:"webhooks"`
 }
 
 // ServerConfig holds server configuration
@@ -42,6 +48,28 @@ type JWTConfig struct {
         SecretKey       string        `yaml:"secret_key"`
         TokenExpiration time.Duration `yaml:"token_expiration"`
         RefreshExpiration time.Duration `yaml:"refresh_expiration"`
+        Algorithm       string        `yaml:"algorithm"`        // HS256, RS256 or EdDSA
+        PrivateKeyFile  string        `yaml:"private_key_file"` // PEM signing key for RS256 and EdDSA
+        PublicKeyFiles  []string      `yaml:"public_key_files"` // PEM keys also published and accepted, e.g. retired or upcoming signing keys
+}
+
+// AuthConfig holds account management configuration
+type AuthConfig struct {
+        AllowRegistration bool `yaml:"allow_registration"`
+        OIDC OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig holds configuration for single sign-on through an OpenID Connect provider
+type OIDCConfig struct {
+        Enabled      bool     `yaml:"enabled"`
+        IssuerURL    string   `yaml:"issuer_url"`
+        ClientID     string   `yaml:"client_id"`
+        ClientSecret string   `yaml:"client_secret"`
+        RedirectURL  string   `yaml:"redirect_url"` // the callback endpoint, as registered with the provider
+        Scopes       []string `yaml:"scopes"`
+        GroupsClaim  string   `yaml:"groups_claim"`  // ID token claim listing the user's groups; dots address nested claims
+        RoleMappings []string `yaml:"role_mappings"` // group=role pairs, the first matching group wins
+        DefaultRole  string   `yaml:"default_role"`  // role of users in no mapped group
 }
 
 // MetricsConfig holds metrics configuration
@@ -51,6 +79,36 @@ type MetricsConfig struct {
         Port    int    `yaml:"port"`
 }
 
+// SnapshotConfig holds configuration for the task metrics snapshotter
+type SnapshotConfig struct {
+        Enabled  bool          `yaml:"enabled"`
+        Interval time.Duration `yaml:"interval"`
+}
+
+// AttachmentsConfig holds configuration for task attachments
+type AttachmentsConfig struct {
+        StoragePath string `yaml:"storage_path"`
+        MaxSize     int    `yaml:"max_size"` // bytes
+}
+
+// RecurrenceConfig holds configuration for the recurring task scheduler
+type RecurrenceConfig struct {
+        Enabled  bool          `yaml:"enabled"`
+        Interval time.Duration `yaml:"interval"`
+        Lead     time.Duration `yaml:"lead"` // how long before an occurrence its task is created
+}
+
+// WebhooksConfig holds configuration for outbound webhook deliveries
+type WebhooksConfig struct {
+        Enabled              bool          `yaml:"enabled"`
+        PollInterval         time.Duration `yaml:"poll_interval"`
+        Timeout              time.Duration `yaml:"timeout"`
+        RetryBase            time.Duration `yaml:"retry_base"` // delay before the first retry, doubled for each later one
+        MaxAttempts          int           `yaml:"max_attempts"`
+        DisableAfter         int           `yaml:"disable_after"`          // consecutive failed attempts before a webhook is disabled
+        AllowPrivateNetworks bool          `yaml:"allow_private_networks"` // let webhooks reach loopback and private addresses, for local development only
+}
+
 // Load reads configuration from environment variables with defaults
 func Load() (*Config, error) {
         config := &Config{
@@ -76,17 +134,80 @@ func Load() (*Config, error) {
                         SecretKey:         getEnv("JWT_SECRET_KEY", "your-secret-key-change-this-in-production"),
                         TokenExpiration:   getEnvAsDuration("JWT_TOKEN_EXPIRATION", 24*time.Hour),
                         RefreshExpiration: getEnvAsDuration("JWT_REFRESH_EXPIRATION", 7*24*time.Hour),
+                        Algorithm:         getEnv("JWT_ALGORITHM", "HS256"),
+                        PrivateKeyFile:    getEnv("JWT_PRIVATE_KEY_FILE", ""),
+                        PublicKeyFiles:    getEnvAsSlice("JWT_PUBLIC_KEY_FILES", nil),
+                },
+                Auth: AuthConfig{
+                        AllowRegistration: getEnvAsBool("AUTH_ALLOW_REGISTRATION", false),
+                        OIDC: OIDCConfig{
+                                Enabled:      getEnvAsBool("OIDC_ENABLED", false),
+                                IssuerURL:    getEnv("OIDC_ISSUER_URL", ""),
+                                ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+                                ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+                                RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+                                Scopes:       getEnvAsSlice("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+                                GroupsClaim:  getEnv("OIDC_GROUPS_CLAIM", "groups"),
+                                RoleMappings: getEnvAsSlice("OIDC_ROLE_MAPPINGS", nil),
+                                DefaultRole:  getEnv("OIDC_DEFAULT_ROLE", "user"),
+                        },
                 },
                 Metrics: MetricsConfig{
                         Enabled: getEnvAsBool("METRICS_ENABLED", true),
                         Path:    getEnv("METRICS_PATH", "/metrics"),
                         Port:    getEnvAsInt("METRICS_PORT", 8081),
                 },
+                Snapshot: SnapshotConfig{
+                        Enabled:  getEnvAsBool("SNAPSHOT_ENABLED", true),
+                        Interval: getEnvAsDuration("SNAPSHOT_INTERVAL", 15*time.Minute),
+                },
+                Attachments: AttachmentsConfig{
+                        StoragePath: getEnv("ATTACHMENTS_STORAGE_PATH", "data/attachments"),
+                        MaxSize:     getEnvAsInt("ATTACHMENTS_MAX_SIZE", 25<<20),
+                },
+                Recurrence: RecurrenceConfig{
+                        Enabled:  getEnvAsBool("RECURRENCE_ENABLED", true),
+                        Interval: getEnvAsDuration("RECURRENCE_INTERVAL", time.Minute),
+                        Lead:     getEnvAsDuration("RECURRENCE_LEAD", 24*time.Hour),
+                },
+                Webhooks: WebhooksConfig{
+                        Enabled:              getEnvAsBool("WEBHOOKS_ENABLED", true),
+                        PollInterval:         getEnvAsDuration("WEBHOOKS_POLL_INTERVAL", 5*time.Second),
+                        Timeout:              getEnvAsDuration("WEBHOOKS_TIMEOUT", 10*time.Second),
+                        RetryBase:            getEnvAsDuration("WEBHOOKS_RETRY_BASE", 30*time.Second),
+                        MaxAttempts:          getEnvAsInt("WEBHOOKS_MAX_ATTEMPTS", 8),
+                        DisableAfter:         getEnvAsInt("WEBHOOKS_DISABLE_AFTER", 20),
+                        AllowPrivateNetworks: getEnvAsBool("WEBHOOKS_ALLOW_PRIVATE_NETWORKS", false),
+                },
+        }
+
+        if err := config.validate(); err != nil {
+                return nil, err
         }
 
         return config, nil
 }
 
+// validate rejects settings the background workers cannot run with
+func (c *Config) validate() error {
+        if c.Snapshot.Enabled && c.Snapshot.Interval <= 0 {
+                return fmt.Errorf("SNAPSHOT_INTERVAL must be positive, got %s", c.Snapshot.Interval)
+        }
+        if c.Recurrence.Enabled && c.Recurrence.Interval <= 0 {
+                return fmt.Errorf("RECURRENCE_INTERVAL must be positive, got %s", c.Recurrence.Interval)
+        }
+        if c.Recurrence.Lead < 0 {
+                return fmt.Errorf("RECURRENCE_LEAD must not be negative, got %s", c.Recurrence.Lead)
+        }
+        if c.Webhooks.Enabled && c.Webhooks.PollInterval <= 0 {
+                return fmt.Errorf("WEBHOOKS_POLL_INTERVAL must be positive, got %s", c.Webhooks.PollInterval)
+        }
+        if c.Webhooks.Enabled && c.Webhooks.Timeout <= 0 {
+                return fmt.Errorf("WEBHOOKS_TIMEOUT must be positive, got %s", c.Webhooks.Timeout)
+        }
+        return nil
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
         if value := os.Getenv(key); value != "" {
@@ -115,6 +236,20 @@ func getEnvAsBool(key string, defaultValue bool) bool {
         return defaultValue
 }
 
+// getEnvAsSlice gets a comma-separated environment variable as a slice or returns a default value
+func getEnvAsSlice(key string, defaultValue []string) []string {
+        if value := os.Getenv(key); value != "" {
+                var values []string
+                for _, item := range strings.Split(value, ",") {
+                        if item = strings.TrimSpace(item); item != "" {
+                                values = append(values, item)
+                        }
+                }
+                return values
+        }
+        return defaultValue
+}
+
 // getEnvAsDuration gets an environment variable as duration or returns a default value
 func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
         if value := os.Getenv(key); value != "" {
@@ -41,6 +41,32 @@ func RunMigrations(db *sql.DB) error {
                 createTaskMetricsTableSQL,
                 createIndexesSQL,
                 createHypertableSQL,
+                createProjectMembersTableSQL,
+                createTaskEventsTableSQL,
+                createTaskEventsTriggerSQL,
+                createTaskMetricsIndexesSQL,
+                createTaskFactsTableSQL,
+                createTaskFactsTriggerSQL,
+                continuousAggregateSQL("task_metrics_hourly", "1 hour", "30 minutes"),
+                continuousAggregateSQL("task_metrics_daily", "1 day", "1 hour"),
+                continuousAggregateSQL("task_metrics_weekly", "1 week", "1 day"),
+                continuousAggregateSQL("task_metrics_monthly", "1 month", "1 day"),
+                createTaskSearchSQL,
+                createProjectWorkflowsTableSQL,
+                createTaskDependenciesTableSQL,
+                createTaskParentSQL,
+                createTaskCommentsTableSQL,
+                createWorkLogsTableSQL,
+                createWorkLogsTriggerSQL,
+                createAttachmentsTablesSQL,
+                createTaskRecurrencesTableSQL,
+                createWebhooksTablesSQL,
+                createWebhookDeliveriesTriggerSQL,
+                createTaskEventsNotifySQL,
+                createAuthTokensTablesSQL,
+                createAPIKeysTableSQL,
+                createOIDCTablesSQL,
+                createRolesTableSQL,
         }
 
         for i, migration := range migrations {
@@ -128,4 +154,574 @@ CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 
 const createHypertableSQL = `
 SELECT create_hypertable('task_metrics', 'timestamp', if_not_exists => TRUE);
-`
\ No newline at end of file
+`
+
+const createProjectMembersTableSQL = `
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (project_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_project_members_user ON project_members(user_id);
+`
+
+const createTaskEventsTableSQL = `
+CREATE TABLE IF NOT EXISTS task_events (
+    id BIGSERIAL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    task_id INTEGER NOT NULL,
+    project_id INTEGER NOT NULL,
+    actor_id INTEGER,
+    event_type VARCHAR(20) NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    PRIMARY KEY (id, occurred_at)
+);
+SELECT create_hypertable('task_events', 'occurred_at', if_not_exists => TRUE);
+CREATE INDEX IF NOT EXISTS idx_task_events_task ON task_events(task_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_task_events_project ON task_events(project_id, occurred_at DESC);
+`
+
+// createTaskEventsTriggerSQL records every insert, update and delete on tasks
+// in task_events. The acting user is read from the transaction-local
+// app.actor_id setting; writes made outside a request have no actor.
+const createTaskEventsTriggerSQL = `
+CREATE OR REPLACE FUNCTION record_task_event() RETURNS TRIGGER AS $$
+DECLARE
+    old_row JSONB := '{}';
+    new_row JSONB := '{}';
+    row_task_id INTEGER;
+    row_project_id INTEGER;
+    changed JSONB;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD);
+        row_task_id := OLD.id;
+        row_project_id := OLD.project_id;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW);
+        row_task_id := NEW.id;
+        row_project_id := NEW.project_id;
+    END IF;
+
+    SELECT COALESCE(jsonb_object_agg(k, jsonb_build_object('old', old_row -> k, 'new', new_row -> k)), '{}')
+    INTO changed
+    FROM jsonb_object_keys(old_row || new_row) AS k
+    WHERE k NOT IN ('id', 'created_at', 'updated_at', 'search_vector')
+      AND (old_row -> k) IS DISTINCT FROM (new_row -> k);
+
+    IF TG_OP = 'UPDATE' AND changed = '{}' THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO task_events (task_id, project_id, actor_id, event_type, changes)
+    VALUES (
+        row_task_id,
+        row_project_id,
+        NULLIF(current_setting('app.actor_id', TRUE), '')::INTEGER,
+        CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+        changed
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tasks_record_event ON tasks;
+CREATE TRIGGER tasks_record_event
+    AFTER INSERT OR UPDATE OR DELETE ON tasks
+    FOR EACH ROW EXECUTE FUNCTION record_task_event();
+`
+
+const createTaskMetricsIndexesSQL = `
+CREATE UNIQUE INDEX IF NOT EXISTS idx_task_metrics_project_timestamp ON task_metrics(project_id, timestamp DESC);
+`
+
+// createTaskFactsTableSQL creates task_facts, a narrow copy of tasks
+// partitioned by created_at. The tasks table itself can't become a hypertable
+// because other tables reference its primary key, and continuous aggregates
+// need a hypertable to read from. The table is backfilled once when empty.
+const createTaskFactsTableSQL = `
+CREATE TABLE IF NOT EXISTS task_facts (
+    created_at TIMESTAMPTZ NOT NULL,
+    task_id INTEGER NOT NULL,
+    project_id INTEGER NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    completed_at TIMESTAMPTZ
+);
+SELECT create_hypertable('task_facts', 'created_at', if_not_exists => TRUE);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_task_facts_task ON task_facts(task_id, created_at);
+INSERT INTO task_facts (created_at, task_id, project_id, status, completed_at)
+SELECT created_at, id, project_id, status, completed_at
+FROM tasks
+WHERE created_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM task_facts);
+`
+
+const createTaskFactsTriggerSQL = `
+CREATE OR REPLACE FUNCTION sync_task_fact() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        DELETE FROM task_facts WHERE task_id = OLD.id AND created_at = OLD.created_at;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.created_at IS NOT NULL THEN
+        INSERT INTO task_facts (created_at, task_id, project_id, status, completed_at)
+        VALUES (NEW.created_at, NEW.id, NEW.project_id, NEW.status, NEW.completed_at);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tasks_sync_fact ON tasks;
+CREATE TRIGGER tasks_sync_fact
+    AFTER INSERT OR DELETE OR UPDATE OF created_at, project_id, status, completed_at ON tasks
+    FOR EACH ROW EXECUTE FUNCTION sync_task_fact();
+`
+
+// continuousAggregateSQL creates a continuous aggregate of task counts over
+// task_facts with the given bucket width. The refresh policy leaves the
+// current bucket unmaterialized and starts from the beginning of time, so
+// edits to old tasks are picked up on the next refresh. Tasks count as
+// completed once they have completed_at, which follows each project's
+// workflow.
+func continuousAggregateSQL(view, width, schedule string) string {
+        return fmt.Sprintf(`
+CREATE MATERIALIZED VIEW IF NOT EXISTS %[1]s
+WITH (timescaledb.continuous, timescaledb.materialized_only = true) AS
+SELECT
+    time_bucket(INTERVAL '%[2]s', created_at) AS bucket,
+    project_id,
+    COUNT(*) AS total_tasks,
+    COUNT(*) FILTER (WHERE completed_at IS NOT NULL) AS completed_tasks,
+    COUNT(*) FILTER (WHERE status = 'in_progress') AS in_progress_tasks,
+    SUM(EXTRACT(EPOCH FROM (completed_at - created_at))/3600) FILTER (WHERE completed_at IS NOT NULL) AS completion_hours_sum,
+    COUNT(*) FILTER (WHERE completed_at IS NOT NULL) AS completion_count
+FROM task_facts
+GROUP BY bucket, project_id
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('%[1]s',
+    start_offset => NULL,
+    end_offset => INTERVAL '%[2]s',
+    schedule_interval => INTERVAL '%[3]s',
+    if_not_exists => TRUE);
+`, view, width, schedule)
+}
+
+const createTaskSearchSQL = `
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+    ) STORED;
+CREATE INDEX IF NOT EXISTS idx_tasks_search ON tasks USING GIN(search_vector);
+`
+
+const createProjectWorkflowsTableSQL = `
+CREATE TABLE IF NOT EXISTS project_workflows (
+    project_id INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    initial_status VARCHAR(50) NOT NULL,
+    statuses TEXT[] NOT NULL,
+    transitions JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+ALTER TABLE project_workflows ADD COLUMN IF NOT EXISTS completed_statuses TEXT[] NOT NULL DEFAULT '{done}';
+`
+
+// createTaskDependenciesTableSQL creates task_dependencies, where each row
+// says task_id is blocked by blocked_by_id. Cycles are rejected by the API
+// before insert.
+const createTaskDependenciesTableSQL = `
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    blocked_by_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (task_id, blocked_by_id),
+    CHECK (task_id <> blocked_by_id)
+);
+CREATE INDEX IF NOT EXISTS idx_task_dependencies_blocked_by ON task_dependencies(blocked_by_id);
+`
+
+// createTaskParentSQL lets tasks nest under a parent task in the same
+// project. Deleting a parent through the API either re-parents or deletes its
+// subtasks; the SET NULL only covers rows deleted directly.
+const createTaskParentSQL = `
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES tasks(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks(parent_id) WHERE parent_id IS NOT NULL;
+`
+
+// createTaskCommentsTableSQL creates task_comments and the history of their
+// edits. root_id is the top-level comment of a reply's thread, so a thread
+// can be loaded without walking it.
+const createTaskCommentsTableSQL = `
+CREATE TABLE IF NOT EXISTS task_comments (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES task_comments(id) ON DELETE CASCADE,
+    root_id INTEGER REFERENCES task_comments(id) ON DELETE CASCADE,
+    author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    edited_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_task_comments_task ON task_comments(task_id, id) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_task_comments_root ON task_comments(root_id, id);
+
+CREATE TABLE IF NOT EXISTS task_comment_edits (
+    id SERIAL PRIMARY KEY,
+    comment_id INTEGER NOT NULL REFERENCES task_comments(id) ON DELETE CASCADE,
+    editor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    previous_body TEXT NOT NULL,
+    edited_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_task_comment_edits_comment ON task_comment_edits(comment_id, edited_at);
+`
+
+// createWorkLogsTableSQL creates the work_logs hypertable of time entries. An
+// entry without a duration is a running timer. Existing actual_hours values
+// are carried over once, as unattributed entries, when the table is empty.
+const createWorkLogsTableSQL = `
+CREATE TABLE IF NOT EXISTS work_logs (
+    id BIGSERIAL,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    duration_seconds INTEGER CHECK (duration_seconds > 0),
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (id, started_at)
+);
+SELECT create_hypertable('work_logs', 'started_at', if_not_exists => TRUE);
+CREATE INDEX IF NOT EXISTS idx_work_logs_task ON work_logs(task_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_work_logs_user ON work_logs(user_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_work_logs_running ON work_logs(user_id) WHERE duration_seconds IS NULL;
+INSERT INTO work_logs (task_id, user_id, started_at, duration_seconds, note)
+SELECT id, NULL, COALESCE(completed_at, updated_at, created_at), ROUND(actual_hours * 3600), 'Carried over from actual_hours'
+FROM tasks
+WHERE actual_hours > 0 AND NOT EXISTS (SELECT 1 FROM work_logs);
+`
+
+// createWorkLogsTriggerSQL keeps tasks.actual_hours equal to the sum of the
+// task's finished work log entries
+const createWorkLogsTriggerSQL = `
+CREATE OR REPLACE FUNCTION sync_task_actual_hours() RETURNS TRIGGER AS $$
+DECLARE
+    affected INTEGER[] := '{}';
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        affected := affected || OLD.task_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        affected := affected || NEW.task_id;
+    END IF;
+
+    UPDATE tasks t
+    SET actual_hours = (SELECT ROUND(SUM(w.duration_seconds) / 3600.0, 2) FROM work_logs w WHERE w.task_id = t.id)
+    WHERE t.id = ANY(affected)
+      AND t.actual_hours IS DISTINCT FROM (SELECT ROUND(SUM(w.duration_seconds) / 3600.0, 2) FROM work_logs w WHERE w.task_id = t.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS work_logs_sync_actual_hours ON work_logs;
+CREATE TRIGGER work_logs_sync_actual_hours
+    AFTER INSERT OR UPDATE OR DELETE ON work_logs
+    FOR EACH ROW EXECUTE FUNCTION sync_task_actual_hours();
+`
+
+// createAttachmentsTablesSQL creates blobs, one row per stored content hash,
+// and task_attachments, which point tasks at blobs. Attachments with the same
+// content share a blob; blobs are removed once nothing references them.
+const createAttachmentsTablesSQL = `
+CREATE TABLE IF NOT EXISTS blobs (
+    hash CHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS task_attachments (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    blob_hash CHAR(64) NOT NULL REFERENCES blobs(hash),
+    filename VARCHAR(255) NOT NULL,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_task_attachments_task ON task_attachments(task_id);
+CREATE INDEX IF NOT EXISTS idx_task_attachments_blob ON task_attachments(blob_hash);
+`
+
+// createTaskRecurrencesTableSQL creates task_recurrences, which repeat a
+// template task on an RRULE schedule, and task_occurrences, which record the
+// task created for each occurrence. The occurrence key keeps the scheduler
+// from creating an occurrence twice.
+const createTaskRecurrencesTableSQL = `
+CREATE TABLE IF NOT EXISTS task_recurrences (
+    id SERIAL PRIMARY KEY,
+    template_task_id INTEGER NOT NULL UNIQUE REFERENCES tasks(id) ON DELETE CASCADE,
+    rrule TEXT NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    next_at TIMESTAMPTZ,
+    last_error TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_task_recurrences_next ON task_recurrences(next_at) WHERE next_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS task_occurrences (
+    recurrence_id INTEGER NOT NULL REFERENCES task_recurrences(id) ON DELETE CASCADE,
+    occurrence_at TIMESTAMPTZ NOT NULL,
+    task_id INTEGER REFERENCES tasks(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (recurrence_id, occurrence_at)
+);
+`
+
+// createWebhooksTablesSQL creates webhooks, the event subscriptions, and
+// webhook_deliveries, the log of events queued for and sent to them
+const createWebhooksTablesSQL = `
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    event_types TEXT[] NOT NULL,
+    project_ids INTEGER[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    disabled_at TIMESTAMPTZ,
+    disabled_reason TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner ON webhooks(owner_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ DEFAULT NOW(),
+    last_attempt_at TIMESTAMPTZ,
+    response_status INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+`
+
+// createWebhookDeliveriesTriggerSQL queues a delivery for every matching
+// webhook when a task event is recorded, in the same transaction as the task
+// change, so events are neither lost nor sent for rolled back changes.
+// Webhooks only receive events while their owner may still subscribe to
+// them: webhooks for every project while the owner is an admin, others while
+// the owner administers the event's project.
+const createWebhookDeliveriesTriggerSQL = `
+CREATE OR REPLACE FUNCTION webhook_owner_can_receive(owner INTEGER, project_ids INTEGER[], project INTEGER) RETURNS BOOLEAN AS $$
+BEGIN
+    RETURN EXISTS (
+        SELECT 1
+        FROM users u
+        LEFT JOIN roles r ON r.name = u.role
+        WHERE u.id = owner AND (
+            r.permissions && '{*}'::TEXT[]
+            OR cardinality(project_ids) > 0 AND (
+                r.permissions && '{project:admin}'::TEXT[]
+                OR EXISTS (SELECT 1 FROM projects p WHERE p.id = project AND p.owner_id = owner)
+                OR EXISTS (
+                    SELECT 1
+                    FROM project_members m
+                    JOIN roles mr ON mr.name = m.role
+                    WHERE m.project_id = project AND m.user_id = owner
+                      AND mr.permissions && '{*,project:admin}'::TEXT[]
+                )
+            )
+        )
+    );
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+CREATE OR REPLACE FUNCTION enqueue_webhook_deliveries() RETURNS TRIGGER AS $$
+DECLARE
+    base_type TEXT := 'task.' || NEW.event_type;
+    completed BOOLEAN := NEW.event_type = 'updated'
+        AND NEW.changes -> 'completed_at' ->> 'old' IS NULL
+        AND NEW.changes -> 'completed_at' ->> 'new' IS NOT NULL;
+    task_row JSONB;
+BEGIN
+    SELECT to_jsonb(t) - 'search_vector' INTO task_row FROM tasks t WHERE t.id = NEW.task_id;
+
+    INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+    SELECT w.id, NEW.id, d.event_type, jsonb_build_object(
+        'event_id', NEW.id,
+        'event', d.event_type,
+        'occurred_at', NEW.occurred_at,
+        'task_id', NEW.task_id,
+        'project_id', NEW.project_id,
+        'actor_id', NEW.actor_id,
+        'changes', NEW.changes,
+        'task', task_row
+    )
+    FROM webhooks w
+    CROSS JOIN LATERAL (
+        SELECT CASE WHEN completed AND 'task.completed' = ANY(w.event_types) THEN 'task.completed' ELSE base_type END AS event_type
+    ) d
+    WHERE w.active
+      AND (cardinality(w.project_ids) = 0 OR NEW.project_id = ANY(w.project_ids))
+      AND d.event_type = ANY(w.event_types)
+      AND webhook_owner_can_receive(w.owner_id, w.project_ids, NEW.project_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_events_enqueue_webhooks ON task_events;
+CREATE TRIGGER task_events_enqueue_webhooks
+    AFTER INSERT ON task_events
+    FOR EACH ROW EXECUTE FUNCTION enqueue_webhook_deliveries();
+`
+
+// createTaskEventsNotifySQL announces every recorded task event on the
+// task_events channel when its transaction commits, so each replica can push
+// it to its connected streams. The payload only identifies the event to stay
+// under the NOTIFY size limit.
+const createTaskEventsNotifySQL = `
+CREATE OR REPLACE FUNCTION notify_task_event() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('task_events', json_build_object(
+        'id', NEW.id,
+        'occurred_at', NEW.occurred_at,
+        'project_id', NEW.project_id
+    )::TEXT);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_events_notify ON task_events;
+CREATE TRIGGER task_events_notify
+    AFTER INSERT ON task_events
+    FOR EACH ROW EXECUTE FUNCTION notify_task_event();
+`
+
+// createAuthTokensTablesSQL stores refresh tokens by hash, grouped into one
+// family per login session, and the IDs of access tokens revoked before they
+// expire
+const createAuthTokensTablesSQL = `
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens(expires_at);
+`
+
+// createAPIKeysTableSQL stores API keys by hash. project_ids is empty for
+// keys that may use every project their user can access.
+const createAPIKeysTableSQL = `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    project_ids INTEGER[] NOT NULL DEFAULT '{}',
+    permission VARCHAR(10) NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);
+`
+
+// createOIDCTablesSQL links users to their single sign-on identities and
+// keeps the logins in progress until the provider redirects back, along with
+// the account a login links to when started by a signed in user. SSO users
+// are created with an empty password_hash, so they cannot log in with a
+// password. users.email_verified records whether an identity provider has
+// vouched for the account's current email address.
+const createOIDCTablesSQL = `
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    state VARCHAR(64) PRIMARY KEY,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+ALTER TABLE oidc_logins ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+// createRolesTableSQL defines roles as sets of permissions. users.role is
+// each user's global role and project_members.role their role in a project.
+// The built-in roles keep the access the fixed roles used to grant; roles
+// already given to users or members start without permissions. Both columns
+// reference roles, so roles in use cannot be deleted.
+const createRolesTableSQL = `
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    builtin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+INSERT INTO roles (name, description, permissions, builtin) VALUES
+    ('admin', 'Every permission everywhere', '{*}', TRUE),
+    ('user', 'Create projects and read metrics of the projects they can see', '{project:create,metrics:read}', TRUE),
+    ('viewer', 'Read a project''s tasks and metrics', '{task:read,metrics:read}', TRUE),
+    ('member', 'Read and change a project''s tasks', '{task:read,task:write,metrics:read}', TRUE),
+    ('maintainer', 'Read and change a project''s tasks and manage the project', '{task:read,task:write,metrics:read,project:admin}', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO roles (name)
+SELECT role FROM users WHERE role IS NOT NULL
+UNION
+SELECT role FROM project_members
+ON CONFLICT (name) DO NOTHING;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'users_role_fkey') THEN
+        ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'project_members_role_fkey') THEN
+        ALTER TABLE project_members ADD CONSTRAINT project_members_role_fkey FOREIGN KEY (role) REFERENCES roles(name);
+    END IF;
+END $$;
+`
@@ -32,6 +32,32 @@ func NewMockConnection() (*sql.DB, sqlmock.Sqlmock, error) {
         mock.ExpectExec("CREATE INDEX IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
         mock.ExpectExec("CREATE INDEX IF NOT EXISTS").WillReturnResult(sqlmock.NewResult(0, 0))
         mock.ExpectQuery("SELECT create_hypertable").WillReturnRows(sqlmock.NewRows([]string{"create_hypertable"}).AddRow("1"))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS project_members").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS task_events").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE OR REPLACE FUNCTION record_task_event").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE UNIQUE INDEX IF NOT EXISTS idx_task_metrics_project_timestamp").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS task_facts").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE OR REPLACE FUNCTION sync_task_fact").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE MATERIALIZED VIEW IF NOT EXISTS task_metrics_hourly").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE MATERIALIZED VIEW IF NOT EXISTS task_metrics_daily").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE MATERIALIZED VIEW IF NOT EXISTS task_metrics_weekly").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE MATERIALIZED VIEW IF NOT EXISTS task_metrics_monthly").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS project_workflows").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS task_dependencies").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("ALTER TABLE tasks ADD COLUMN IF NOT EXISTS parent_id").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS task_comments").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS work_logs").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE OR REPLACE FUNCTION sync_task_actual_hours").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS blobs").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS task_recurrences").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS webhooks").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE OR REPLACE FUNCTION webhook_owner_can_receive").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE OR REPLACE FUNCTION notify_task_event").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS refresh_tokens").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS api_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS user_identities").WillReturnResult(sqlmock.NewResult(0, 0))
+        mock.ExpectExec("CREATE TABLE IF NOT EXISTS roles").WillReturnResult(sqlmock.NewResult(0, 0))
 
         return db, mock, nil
 }
@@ -47,16 +73,22 @@ func SetupMockLogin(mock sqlmock.Sqlmock) {
 
 // SetupMockTasks sets up mock expectations for task operations
 func SetupMockTasks(mock sqlmock.Sqlmock) {
+        // Mock project workflow lookup (no stored workflow, so the default applies)
+        mock.ExpectQuery("SELECT w.initial_status").
+                WithArgs(sqlmock.AnyArg()).
+                WillReturnRows(sqlmock.NewRows([]string{"initial_status", "statuses", "transitions", "updated_at"}).
+                        AddRow(nil, nil, nil, nil))
+
         // Mock task creation
         mock.ExpectQuery("INSERT INTO tasks").
-                WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
-                WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "status", "priority", "assignee_id", "project_id", "created_at", "updated_at", "completed_at", "due_date", "estimated_hours", "actual_hours", "tags"}).
-                        AddRow(1, "Test Task", "A test task", "todo", 1, nil, 1, time.Now(), time.Now(), nil, nil, nil, nil, "{}"))
+                WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+                WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "status", "priority", "assignee_id", "project_id", "created_at", "updated_at", "completed_at", "due_date", "estimated_hours", "actual_hours", "tags", "parent_id"}).
+                        AddRow(1, "Test Task", "A test task", "todo", 1, nil, 1, time.Now(), time.Now(), nil, nil, nil, nil, "{}", nil))
 
         // Mock task retrieval
-        mock.ExpectQuery("SELECT id, title, description, status, priority, assignee_id, project_id, created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags FROM tasks").
-                WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "status", "priority", "assignee_id", "project_id", "created_at", "updated_at", "completed_at", "due_date", "estimated_hours", "actual_hours", "tags"}).
-                        AddRow(1, "Test Task", "A test task", "todo", 1, nil, 1, time.Now(), time.Now(), nil, nil, nil, nil, "{}"))
+        mock.ExpectQuery("SELECT id, title, description, status, priority, assignee_id, project_id, created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags, parent_id FROM tasks").
+                WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "status", "priority", "assignee_id", "project_id", "created_at", "updated_at", "completed_at", "due_date", "estimated_hours", "actual_hours", "tags", "parent_id"}).
+                        AddRow(1, "Test Task", "A test task", "todo", 1, nil, 1, time.Now(), time.Now(), nil, nil, nil, nil, "{}", nil))
 
         // Mock metrics query
         mock.ExpectQuery("SELECT status, project_id, COUNT").
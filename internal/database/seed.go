@@ -3,14 +3,13 @@ package database
 import (
 	"database/sql"
 	"log"
-
-	"golang.org/x/crypto/bcrypt"
+	"scalable-task-api/internal/auth"
 )
 
 // SeedDatabase inserts initial data for testing
 func SeedDatabase(db *sql.DB) error {
 	// Create a test user
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	passwordHash, err := auth.HashPassword("password123")
 	if err != nil {
 		return err
 	}
@@ -20,7 +19,7 @@ func SeedDatabase(db *sql.DB) error {
 		INSERT INTO users (username, email, password_hash, full_name, role) 
 		VALUES ($1, $2, $3, $4, $5) 
 		ON CONFLICT (username) DO NOTHING
-	`, "testuser", "test@example.com", string(passwordHash), "Test User", "admin")
+	`, "testuser", "test@example.com", passwordHash, "Test User", "admin")
 
 	if err != nil {
 		return err
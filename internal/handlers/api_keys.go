@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/auth"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, project_ids, permission, expires_at, last_used_at,
+	created_by, created_at, updated_at`
+
+// apiKeyScanFields returns the scan destinations matching apiKeyColumns
+func apiKeyScanFields(key *models.APIKey) []interface{} {
+	return []interface{}{
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.ProjectIDs), &key.Permission,
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedBy, &key.CreatedAt, &key.UpdatedAt,
+	}
+}
+
+// APIKeyHandler handles API key endpoints. Users manage their own keys and
+// admins manage everyone's, including keys for service accounts.
+type APIKeyHandler struct {
+	db    *sql.DB
+	authz *authz.Authorizer
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(db *sql.DB, authorizer *authz.Authorizer) *APIKeyHandler {
+	return &APIKeyHandler{
+		db:    db,
+		authz: authorizer,
+	}
+}
+
+// GetAPIKeys lists API keys
+// @Summary Get API keys
+// @Description Get the caller's API keys. Admins may list another user's keys with user_id.
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "List this user's keys (admin only)"
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api-keys [get]
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	subject, ok := sessionSubject(c)
+	if !ok {
+		return
+	}
+
+	var query models.APIKeyQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := subject.UserID
+	if query.UserID != nil && *query.UserID != subject.UserID {
+		if !subject.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+			return
+		}
+		userID = *query.UserID
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query API keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := rows.Scan(apiKeyScanFields(&key)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan API key"})
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey creates an API key
+// @Summary Create API key
+// @Description Create an API key that acts as its user, limited to the given projects (all of the user's projects when empty) and to read or write access. Read keys can only make GET requests. Send it as "Authorization: Bearer <key>" or "X-API-Key: <key>". The key is only shown in this response. Admins may set user_id to create a key for another user, such as a service account.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPIKeyRequest true "API key information"
+// @Success 201 {object} models.APIKey
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	subject, ok := sessionSubject(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner := subject
+	if req.UserID != nil && *req.UserID != subject.UserID {
+		if !subject.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create API keys for other users"})
+			return
+		}
+		if owner, ok = h.keyOwner(c, *req.UserID); !ok {
+			return
+		}
+	}
+
+	if req.ProjectIDs == nil {
+		req.ProjectIDs = []int64{}
+	}
+	if !validAPIKeyExpiry(c, req.ExpiresAt) || !h.canScope(c, owner, req.ProjectIDs) {
+		return
+	}
+
+	secret, hash, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	var key models.APIKey
+	err = h.db.QueryRow(`
+		INSERT INTO api_keys (user_id, name, key_hash, prefix, project_ids, permission, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+apiKeyColumns,
+		owner.UserID, req.Name, hash, prefix, pq.Array(req.ProjectIDs), req.Permission, req.ExpiresAt, subject.UserID,
+	).Scan(apiKeyScanFields(&key)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	key.Key = secret
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// GetAPIKey retrieves an API key by ID
+// @Summary Get API key
+// @Description Get an API key by ID. The key itself is not returned.
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} models.APIKey
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api-keys/{id} [get]
+func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	key, ok := h.ownAPIKey(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// UpdateAPIKey updates an API key
+// @Summary Update API key
+// @Description Rename an API key or change its projects, permission or expiry. The key itself does not change.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Param request body models.UpdateAPIKeyRequest true "API key updates"
+// @Success 200 {object} models.APIKey
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api-keys/{id} [put]
+func (h *APIKeyHandler) UpdateAPIKey(c *gin.Context) {
+	key, ok := h.ownAPIKey(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var setParts []string
+	var args []interface{}
+	argIndex := 1
+
+	if req.Name != nil {
+		setParts = append(setParts, "name = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.Name)
+		argIndex++
+	}
+
+	if req.ProjectIDs != nil {
+		owner, ok := h.keyOwner(c, key.UserID)
+		if !ok || !h.canScope(c, owner, req.ProjectIDs) {
+			return
+		}
+		setParts = append(setParts, "project_ids = $"+strconv.Itoa(argIndex))
+		args = append(args, pq.Array(req.ProjectIDs))
+		argIndex++
+	}
+
+	if req.Permission != nil {
+		setParts = append(setParts, "permission = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.Permission)
+		argIndex++
+	}
+
+	if req.ExpiresAt != nil {
+		if !validAPIKeyExpiry(c, req.ExpiresAt) {
+			return
+		}
+		setParts = append(setParts, "expires_at = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.ExpiresAt)
+		argIndex++
+	}
+
+	if len(setParts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	setParts = append(setParts, "updated_at = NOW()")
+	args = append(args, key.ID)
+
+	err := h.db.QueryRow(`
+		UPDATE api_keys SET `+strings.Join(setParts, ", ")+`
+		WHERE id = $`+strconv.Itoa(argIndex)+`
+		RETURNING `+apiKeyColumns,
+		args...,
+	).Scan(apiKeyScanFields(&key)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// DeleteAPIKey revokes an API key
+// @Summary Delete API key
+// @Description Revoke an API key. Requests made with it fail from then on.
+// @Tags api-keys
+// @Security BearerAuth
+// @Param id path int true "API key ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api-keys/{id} [delete]
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	key, ok := h.ownAPIKey(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.Exec(`DELETE FROM api_keys WHERE id = $1`, key.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API key"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// sessionSubject returns the caller, who must have logged in rather than use
+// an API key, so a leaked key cannot be used to mint others. If not, it writes
+// the error response.
+func sessionSubject(c *gin.Context) (authz.Subject, bool) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return subject, false
+	}
+	if subject.Scope != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot be managed with an API key"})
+		return subject, false
+	}
+	return subject, true
+}
+
+// ownAPIKey loads the API key named by the id parameter if the caller owns it
+// or is an admin, writing the error response if not
+func (h *APIKeyHandler) ownAPIKey(c *gin.Context) (models.APIKey, bool) {
+	var key models.APIKey
+
+	subject, ok := sessionSubject(c)
+	if !ok {
+		return key, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return key, false
+	}
+
+	err = h.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id).Scan(apiKeyScanFields(&key)...)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API key"})
+		return key, false
+	}
+
+	// Other users' keys are reported as missing
+	if err == sql.ErrNoRows || !subject.IsAdmin() && key.UserID != subject.UserID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return key, false
+	}
+
+	return key, true
+}
+
+// keyOwner returns the subject a key for the given user acts as, with the
+// permissions of their global role, writing the error response if the user
+// does not exist
+func (h *APIKeyHandler) keyOwner(c *gin.Context, userID int) (authz.Subject, bool) {
+	owner := authz.Subject{UserID: userID}
+	err := h.db.QueryRow(`SELECT COALESCE(role, 'user') FROM users WHERE id = $1`, userID).Scan(&owner.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return owner, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return owner, false
+	}
+
+	if owner.Permissions, err = h.authz.RolePermissions(owner.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		return owner, false
+	}
+	return owner, true
+}
+
+// canScope checks that the key's user can read every project the key is
+// limited to, writing the error response if not
+func (h *APIKeyHandler) canScope(c *gin.Context, owner authz.Subject, projectIDs []int64) bool {
+	for _, projectID := range projectIDs {
+		if err := h.authz.RequireProject(owner, int(projectID), authz.AccessRead); err != nil {
+			respondAuthzError(c, err, "Project")
+			return false
+		}
+	}
+	return true
+}
+
+// validAPIKeyExpiry checks that an expiry, if set, is in the future, writing
+// the error response if not
+func validAPIKeyExpiry(c *gin.Context, expiresAt *time.Time) bool {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"scalable-task-api/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead is the room left for multipart headers on top of the
+// attachment size limit
+const multipartOverhead = 1 << 20
+
+// blobCollectTimeout bounds how long collectBlobs may take
+const blobCollectTimeout = 5 * time.Minute
+
+const attachmentColumns = `a.id, a.task_id, a.filename, b.content_type, b.size, a.blob_hash, a.uploaded_by, a.created_at`
+
+// attachmentScanFields returns the scan destinations matching attachmentColumns
+func attachmentScanFields(attachment *models.TaskAttachment) []interface{} {
+	return []interface{}{
+		&attachment.ID, &attachment.TaskID, &attachment.Filename, &attachment.ContentType,
+		&attachment.Size, &attachment.SHA256, &attachment.UploadedBy, &attachment.CreatedAt,
+	}
+}
+
+// AttachmentHandler handles task attachment endpoints
+type AttachmentHandler struct {
+	db      *sql.DB
+	authz   *authz.Authorizer
+	blobs   storage.BlobStore
+	maxSize int64
+}
+
+// NewAttachmentHandler creates a new attachment handler. Uploads larger than
+// maxSize bytes are rejected.
+func NewAttachmentHandler(db *sql.DB, authorizer *authz.Authorizer, blobs storage.BlobStore, maxSize int) *AttachmentHandler {
+	return &AttachmentHandler{
+		db:      db,
+		authz:   authorizer,
+		blobs:   blobs,
+		maxSize: int64(maxSize),
+	}
+}
+
+// lockBlob serializes work on one blob between uploads and garbage
+// collection until tx ends
+func lockBlob(tx *sql.Tx, hash string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('blob:' || $1))`, hash)
+	return err
+}
+
+// collectBlobs deletes the given blobs if no attachment references them any
+// more. It runs after the transaction that released them has committed, on
+// its own context so a client disconnecting does not stop it halfway;
+// failures only leave unreferenced content behind, so they are logged.
+func collectBlobs(db *sql.DB, blobs storage.BlobStore, hashes []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), blobCollectTimeout)
+	defer cancel()
+
+	for _, hash := range hashes {
+		if err := collectBlob(ctx, db, blobs, hash); err != nil {
+			log.Printf("Failed to collect blob %s: %v", hash, err)
+		}
+	}
+}
+
+func collectBlob(ctx context.Context, db *sql.DB, blobs storage.BlobStore, hash string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockBlob(tx, hash); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM blobs b
+		WHERE b.hash = $1 AND NOT EXISTS (SELECT 1 FROM task_attachments a WHERE a.blob_hash = b.hash)
+	`, hash)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	// Remove the content while the lock still keeps uploads of the same
+	// content waiting
+	if err := blobs.Delete(ctx, hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAttachments lists the attachments of a task
+// @Summary Get task attachments
+// @Description Get the metadata of the files attached to a task, oldest first
+// @Tags attachments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {array} models.TaskAttachment
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/attachments [get]
+func (h *AttachmentHandler) GetAttachments(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+attachmentColumns+`
+		FROM task_attachments a
+		JOIN blobs b ON b.hash = a.blob_hash
+		WHERE a.task_id = $1
+		ORDER BY a.id
+	`, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query attachments"})
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.TaskAttachment{}
+	for rows.Next() {
+		var attachment models.TaskAttachment
+		if err := rows.Scan(attachmentScanFields(&attachment)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan attachment"})
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+// UploadAttachment attaches a file to a task
+// @Summary Upload task attachment
+// @Description Attach a file to a task as multipart form field "file". The content type is detected from the content, and identical files are stored once.
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param file formData file true "File to attach"
+// @Success 201 {object} models.TaskAttachment
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Router /tasks/{id}/attachments [post]
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, authz.AccessWrite); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	tooLarge := gin.H{"error": "File exceeds the maximum size of " + strconv.FormatInt(h.maxSize, 10) + " bytes"}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxSize+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Multipart field \"file\" is required"})
+		return
+	}
+	if header.Size > h.maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+
+	filename := filepath.Base(header.Filename)
+	if filename == "." || filename == string(filepath.Separator) || len(filename) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filename"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	defer file.Close()
+
+	// Sniff the type from the first bytes and hash the whole content, then
+	// rewind to store it
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+
+	hasher := sha256.New()
+	hasher.Write(sniff[:n])
+	if _, err := io.Copy(hasher, file); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockBlob(tx, hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO blobs (hash, size, content_type) VALUES ($1, $2, $3)
+		ON CONFLICT (hash) DO NOTHING
+	`, hash, header.Size, contentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+
+	var attachment models.TaskAttachment
+	err = tx.QueryRow(`
+		WITH a AS (
+			INSERT INTO task_attachments (task_id, blob_hash, filename, uploaded_by)
+			VALUES ($1, $2, $3, $4)
+			RETURNING *
+		)
+		SELECT `+attachmentColumns+`
+		FROM a
+		JOIN blobs b ON b.hash = a.blob_hash
+	`, taskID, hash, filename, subject.UserID).Scan(attachmentScanFields(&attachment)...)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+
+	// Stored content is immutable, so this is a no-op when the blob exists
+	if err := h.blobs.Put(c.Request.Context(), hash, file); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// DownloadAttachment streams the content of an attachment
+// @Summary Download task attachment
+// @Description Download an attached file. It is always served as a download with its detected content type.
+// @Tags attachments
+// @Produce octet-stream
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param attachment_id path int true "Attachment ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/attachments/{attachment_id} [get]
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	taskID, attachmentID, ok := h.attachmentParams(c, authz.AccessRead)
+	if !ok {
+		return
+	}
+
+	var attachment models.TaskAttachment
+	err := h.db.QueryRow(`
+		SELECT `+attachmentColumns+`
+		FROM task_attachments a
+		JOIN blobs b ON b.hash = a.blob_hash
+		WHERE a.id = $1 AND a.task_id = $2
+	`, attachmentID, taskID).Scan(attachmentScanFields(&attachment)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attachment"})
+		return
+	}
+
+	content, err := h.blobs.Get(c.Request.Context(), attachment.SHA256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment"})
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}),
+		"X-Content-Type-Options": "nosniff",
+		"ETag":                   `"` + attachment.SHA256 + `"`,
+	})
+}
+
+// DeleteAttachment removes an attachment from a task
+// @Summary Delete task attachment
+// @Description Remove an attachment from a task. Its content is deleted once no other attachment uses it.
+// @Tags attachments
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param attachment_id path int true "Attachment ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/attachments/{attachment_id} [delete]
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	taskID, attachmentID, ok := h.attachmentParams(c, authz.AccessWrite)
+	if !ok {
+		return
+	}
+
+	var hash string
+	err := h.db.QueryRow(`
+		DELETE FROM task_attachments WHERE id = $1 AND task_id = $2
+		RETURNING blob_hash
+	`, attachmentID, taskID).Scan(&hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+
+	collectBlobs(h.db, h.blobs, []string{hash})
+
+	c.Status(http.StatusNoContent)
+}
+
+// attachmentParams parses the task and attachment IDs of an attachment route
+// and checks the caller's access to the task, writing the error response if
+// any step fails
+func (h *AttachmentHandler) attachmentParams(c *gin.Context, need authz.Access) (int, int, bool) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return 0, 0, false
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return 0, 0, false
+	}
+
+	attachmentID, err := strconv.Atoi(c.Param("attachment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return 0, 0, false
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, need); err != nil {
+		respondAuthzError(c, err, "Task")
+		return 0, 0, false
+	}
+
+	return taskID, attachmentID, true
+}
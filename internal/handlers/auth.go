@@ -4,23 +4,30 @@ import (
 	"database/sql"
 	"net/http"
 	"scalable-task-api/internal/auth"
+	"scalable-task-api/internal/config"
 	"scalable-task-api/internal/models"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthHandler handles authentication-related endpoints
 type AuthHandler struct {
 	db         *sql.DB
 	jwtService *auth.JWTService
+	tokens     *auth.TokenStore
+	oidc       *auth.OIDCProvider
+	config     *config.AuthConfig
 }
 
-// NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *sql.DB, jwtService *auth.JWTService) *AuthHandler {
+// NewAuthHandler creates a new auth handler. oidc is nil when single sign-on
+// is disabled.
+func NewAuthHandler(db *sql.DB, jwtService *auth.JWTService, tokens *auth.TokenStore, oidc *auth.OIDCProvider, cfg *config.AuthConfig) *AuthHandler {
 	return &AuthHandler{
 		db:         db,
 		jwtService: jwtService,
+		tokens:     tokens,
+		oidc:       oidc,
+		config:     cfg,
 	}
 }
 
@@ -63,27 +70,31 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+	if err := auth.CheckPassword(passwordHash, req.Password); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Generate tokens
-	accessToken, err := h.jwtService.GenerateToken(user.ID, user.Username, user.Role)
+	h.startSession(c, user.ID, user.Username, user.Role)
+}
+
+// startSession issues the tokens of a new session for a user who has logged in
+func (h *AuthHandler) startSession(c *gin.Context, userID int, username, role string) {
+	refreshToken, err := h.tokens.IssueRefreshToken(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
 		return
 	}
 
-	refreshToken, err := h.jwtService.GenerateRefreshToken(user.ID, user.Username, user.Role)
+	accessToken, err := h.jwtService.GenerateToken(userID, username, role, refreshToken.FamilyID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
 		return
 	}
 
 	response := auth.TokenResponse{
 		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		RefreshToken: refreshToken.Token,
 		TokenType:    "Bearer",
 		ExpiresIn:    int64(24 * 60 * 60), // 24 hours in seconds
 	}
@@ -93,7 +104,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 // RefreshToken handles token refresh
 // @Summary Refresh access token
-// @Description Generate new access token using refresh token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used once; presenting one that was already used ends its session, including the access tokens issued in it.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -109,15 +120,36 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Validate refresh token
-	claims, err := h.jwtService.ValidateToken(req.RefreshToken)
+	// Rotate the refresh token
+	refreshToken, err := h.tokens.RotateRefreshToken(req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		switch err {
+		case auth.ErrInvalidRefreshToken:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		case auth.ErrRefreshTokenReused:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token was already used; the session has been revoked"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
+		return
+	}
+
+	// The access token carries the user's current name and role
+	var username, role string
+	err = h.db.QueryRow(`
+		SELECT username, COALESCE(role, 'user') FROM users WHERE id = $1
+	`, refreshToken.UserID).Scan(&username, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
 	// Generate new access token
-	accessToken, err := h.jwtService.GenerateToken(claims.UserID, claims.Username, claims.Role)
+	accessToken, err := h.jwtService.GenerateToken(refreshToken.UserID, username, role, refreshToken.FamilyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
 		return
@@ -125,7 +157,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 
 	response := auth.TokenResponse{
 		AccessToken:  accessToken,
-		RefreshToken: req.RefreshToken, // Keep the same refresh token
+		RefreshToken: refreshToken.Token,
 		TokenType:    "Bearer",
 		ExpiresIn:    int64(24 * 60 * 60), // 24 hours in seconds
 	}
@@ -133,6 +165,64 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Logout ends the current session
+// @Summary Log out
+// @Description Revoke the access token used for the request and end its session, so the session's refresh token and other access tokens stop working. With all set, every session of the user is ended.
+// @Tags auth
+// @Accept json
+// @Security BearerAuth
+// @Param request body auth.LogoutRequest false "Logout options"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	value, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	claims := value.(*auth.Claims)
+
+	var req auth.LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.tokens.RevokeAccessToken(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+
+	var err error
+	if req.All {
+		err = h.tokens.RevokeUser(claims.UserID)
+	} else if claims.SessionID != "" {
+		err = h.tokens.RevokeFamily(claims.UserID, claims.SessionID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// JWKS publishes the public keys access tokens are signed with
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens signed with RS256 or EdDSA, identified by the kid token header. The set lists retired and upcoming keys too, and is empty when tokens are signed with a shared secret.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} auth.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwtService.JWKS())
+}
+
 // Me returns current user information
 // @Summary Get current user
 // @Description Get current authenticated user information
@@ -169,4 +259,84 @@ func (h *AuthHandler) Me(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, user)
-}
\ No newline at end of file
+}
+
+// Register handles self-registration
+// @Summary Register a new account
+// @Description Create a user account with the default role. Only available when registration is enabled.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RegisterRequest true "Account information"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /auth/register [post]
+func (h *AuthHandler) Register(c *gin.Context) {
+	if !h.config.AllowRegistration {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+		return
+	}
+
+	var req models.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := insertUser(h.db, req.Username, req.Email, req.Password, req.FullName, string(models.UserRoleUser))
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username or email already in use"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateMe updates the current user's profile
+// @Summary Update current user
+// @Description Update the authenticated user's full name or email. A new email address is unverified, so single sign-on no longer links to the account by that address; link it through /auth/oidc/link instead.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UpdateProfileRequest true "Profile information"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /auth/me [put]
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields := map[string]interface{}{}
+	if req.Email != nil {
+		fields["email"] = *req.Email
+	}
+	if req.FullName != nil {
+		fields["full_name"] = *req.FullName
+	}
+
+	user, err := updateUser(h.db, userID.(int), fields)
+	if err != nil {
+		respondUserUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
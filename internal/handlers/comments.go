@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultCommentPageSize = 50
+	maxCommentPageSize     = 200
+)
+
+// commentColumns selects a comment from task_comments c joined to its author
+// in users u. The body of a deleted comment is hidden.
+const commentColumns = `c.id, c.task_id, c.parent_id, c.author_id, COALESCE(u.username, ''),
+	CASE WHEN c.deleted_at IS NULL THEN c.body ELSE '' END, c.deleted_at IS NOT NULL,
+	c.created_at, c.updated_at, c.edited_at`
+
+// commentScanFields returns the scan destinations matching commentColumns
+func commentScanFields(comment *models.TaskComment) []interface{} {
+	return []interface{}{
+		&comment.ID, &comment.TaskID, &comment.ParentID, &comment.AuthorID, &comment.AuthorUsername,
+		&comment.Body, &comment.Deleted, &comment.CreatedAt, &comment.UpdatedAt, &comment.EditedAt,
+	}
+}
+
+// CommentHandler handles task comment endpoints
+type CommentHandler struct {
+	db    *sql.DB
+	authz *authz.Authorizer
+}
+
+// NewCommentHandler creates a new comment handler
+func NewCommentHandler(db *sql.DB, authorizer *authz.Authorizer) *CommentHandler {
+	return &CommentHandler{
+		db:    db,
+		authz: authorizer,
+	}
+}
+
+// GetComments retrieves the comment threads of a task
+// @Summary Get task comments
+// @Description Get the top-level comments of a task, oldest first, each with all of its replies. Follow next_cursor (or the Link header) to fetch the next page.
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param limit query int false "Threads per page (max 200)" default(50)
+// @Param cursor query string false "Cursor from a previous page's next_cursor"
+// @Success 200 {object} models.TaskCommentPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/comments [get]
+func (h *CommentHandler) GetComments(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var query models.TaskCommentQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultCommentPageSize
+	}
+	if query.Limit > maxCommentPageSize {
+		query.Limit = maxCommentPageSize
+	}
+
+	afterID := 0
+	if query.Cursor != "" {
+		afterID, err = decodeCommentCursor(query.Cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	// Fetch one extra thread to find out whether there is a next page
+	rows, err := h.db.Query(`
+		SELECT `+commentColumns+`
+		FROM task_comments c
+		LEFT JOIN users u ON u.id = c.author_id
+		WHERE c.task_id = $1 AND c.parent_id IS NULL AND c.id > $2
+		ORDER BY c.id
+		LIMIT $3
+	`, taskID, afterID, query.Limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query comments"})
+		return
+	}
+	defer rows.Close()
+
+	page := models.TaskCommentPage{Data: []models.TaskComment{}}
+	for rows.Next() {
+		var comment models.TaskComment
+		if err := rows.Scan(commentScanFields(&comment)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan comment"})
+			return
+		}
+		page.Data = append(page.Data, comment)
+	}
+
+	if len(page.Data) > query.Limit {
+		page.Data = page.Data[:query.Limit]
+		next := encodeCommentCursor(page.Data[query.Limit-1].ID)
+		page.NextCursor = &next
+	}
+
+	if err := h.attachReplies(page.Data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query comment replies"})
+		return
+	}
+
+	setTaskPageLinks(c, page.NextCursor)
+	c.JSON(http.StatusOK, page)
+}
+
+// attachReplies loads the replies of every thread in threads, oldest first
+func (h *CommentHandler) attachReplies(threads []models.TaskComment) error {
+	if len(threads) == 0 {
+		return nil
+	}
+
+	rootIDs := make([]int64, len(threads))
+	index := make(map[int]int, len(threads))
+	for i, thread := range threads {
+		rootIDs[i] = int64(thread.ID)
+		index[thread.ID] = i
+	}
+
+	rows, err := h.db.Query(`
+		SELECT c.root_id, `+commentColumns+`
+		FROM task_comments c
+		LEFT JOIN users u ON u.id = c.author_id
+		WHERE c.root_id = ANY($1)
+		ORDER BY c.id
+	`, pq.Array(rootIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rootID int
+		var reply models.TaskComment
+		if err := rows.Scan(append([]interface{}{&rootID}, commentScanFields(&reply)...)...); err != nil {
+			return err
+		}
+		i := index[rootID]
+		threads[i].Replies = append(threads[i].Replies, reply)
+	}
+	return rows.Err()
+}
+
+// CreateComment adds a comment to a task
+// @Summary Create task comment
+// @Description Comment on a task, or reply to one of its comments with parent_id. The author is the authenticated user.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param request body models.CreateTaskCommentRequest true "Comment"
+// @Success 201 {object} models.TaskComment
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/comments [post]
+func (h *CommentHandler) CreateComment(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var req models.CreateTaskCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, authz.AccessWrite); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	// Replies join the thread of the comment they answer
+	var rootID *int
+	if req.ParentID != nil {
+		var parentTaskID, parentRootID int
+		var parentDeleted bool
+		err := h.db.QueryRow(`
+			SELECT task_id, COALESCE(root_id, id), deleted_at IS NOT NULL
+			FROM task_comments WHERE id = $1
+		`, *req.ParentID).Scan(&parentTaskID, &parentRootID, &parentDeleted)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+			return
+		}
+		if err == sql.ErrNoRows || parentTaskID != taskID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent comment not found on this task"})
+			return
+		}
+		if parentDeleted {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot reply to a deleted comment"})
+			return
+		}
+		rootID = &parentRootID
+	}
+
+	var comment models.TaskComment
+	err = h.db.QueryRow(`
+		WITH c AS (
+			INSERT INTO task_comments (task_id, parent_id, root_id, author_id, body)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING *
+		)
+		SELECT `+commentColumns+`
+		FROM c
+		LEFT JOIN users u ON u.id = c.author_id
+	`, taskID, req.ParentID, rootID, subject.UserID, req.Body).Scan(commentScanFields(&comment)...)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// UpdateComment edits a comment
+// @Summary Update task comment
+// @Description Replace the body of a comment. Only its author or an admin may edit it, and only while they have write access to the task; the previous body is kept in the comment's history.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param comment_id path int true "Comment ID"
+// @Param request body models.UpdateTaskCommentRequest true "New comment body"
+// @Success 200 {object} models.TaskComment
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/comments/{comment_id} [put]
+func (h *CommentHandler) UpdateComment(c *gin.Context) {
+	subject, taskID, commentID, ok := h.commentParams(c, authz.AccessWrite)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateTaskCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	defer tx.Rollback()
+
+	previousBody, ok := lockOwnComment(c, tx, subject, taskID, commentID)
+	if !ok {
+		return
+	}
+
+	if req.Body != previousBody {
+		_, err = tx.Exec(`
+			INSERT INTO task_comment_edits (comment_id, editor_id, previous_body)
+			VALUES ($1, $2, $3)
+		`, commentID, subject.UserID, previousBody)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+			return
+		}
+	}
+
+	var comment models.TaskComment
+	err = tx.QueryRow(`
+		WITH c AS (
+			UPDATE task_comments
+			SET body = $2,
+			    edited_at = CASE WHEN body = $2 THEN edited_at ELSE NOW() END,
+			    updated_at = NOW()
+			WHERE id = $1
+			RETURNING *
+		)
+		SELECT `+commentColumns+`
+		FROM c
+		LEFT JOIN users u ON u.id = c.author_id
+	`, commentID, req.Body).Scan(commentScanFields(&comment)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment deletes a comment
+// @Summary Delete task comment
+// @Description Delete a comment. Only its author or an admin may delete it, and only while they have write access to the task. Replies stay in the thread under the deleted comment.
+// @Tags comments
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param comment_id path int true "Comment ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/comments/{comment_id} [delete]
+func (h *CommentHandler) DeleteComment(c *gin.Context) {
+	subject, taskID, commentID, ok := h.commentParams(c, authz.AccessWrite)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, ok := lockOwnComment(c, tx, subject, taskID, commentID); !ok {
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE task_comments SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1`, commentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetCommentHistory retrieves the edit history of a comment
+// @Summary Get comment history
+// @Description Get the previous bodies of a comment, oldest first
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param comment_id path int true "Comment ID"
+// @Success 200 {array} models.TaskCommentEdit
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/comments/{comment_id}/history [get]
+func (h *CommentHandler) GetCommentHistory(c *gin.Context) {
+	_, taskID, commentID, ok := h.commentParams(c, authz.AccessRead)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	err := h.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM task_comments WHERE id = $1 AND task_id = $2 AND deleted_at IS NULL)
+	`, commentID, taskID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comment history"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, comment_id, editor_id, previous_body, edited_at
+		FROM task_comment_edits
+		WHERE comment_id = $1
+		ORDER BY edited_at, id
+	`, commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comment history"})
+		return
+	}
+	defer rows.Close()
+
+	edits := []models.TaskCommentEdit{}
+	for rows.Next() {
+		var edit models.TaskCommentEdit
+		if err := rows.Scan(&edit.ID, &edit.CommentID, &edit.EditorID, &edit.PreviousBody, &edit.EditedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan comment edit"})
+			return
+		}
+		edits = append(edits, edit)
+	}
+
+	c.JSON(http.StatusOK, edits)
+}
+
+// commentParams parses the task and comment IDs of a comment route and checks
+// the given access to the task, writing the error response if any step fails
+func (h *CommentHandler) commentParams(c *gin.Context, need authz.Access) (authz.Subject, int, int, bool) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return subject, 0, 0, false
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return subject, 0, 0, false
+	}
+
+	commentID, err := strconv.Atoi(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return subject, 0, 0, false
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, need); err != nil {
+		respondAuthzError(c, err, "Task")
+		return subject, 0, 0, false
+	}
+
+	return subject, taskID, commentID, true
+}
+
+// lockOwnComment locks a live comment of the task for update and checks that
+// the subject wrote it or is an admin. It returns the comment's body, or
+// writes the error response and returns false.
+func lockOwnComment(c *gin.Context, tx *sql.Tx, subject authz.Subject, taskID, commentID int) (string, bool) {
+	var authorID sql.NullInt64
+	var body string
+	err := tx.QueryRow(`
+		SELECT author_id, body FROM task_comments
+		WHERE id = $1 AND task_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, commentID, taskID).Scan(&authorID, &body)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get comment"})
+		return "", false
+	}
+
+	if !subject.IsAdmin() && !(authorID.Valid && int(authorID.Int64) == subject.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author or an admin can change this comment"})
+		return "", false
+	}
+
+	return body, true
+}
+
+// encodeCommentCursor builds the cursor pointing just past the thread with id
+func encodeCommentCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+// decodeCommentCursor returns the thread ID a cursor points past
+func decodeCommentCursor(encoded string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	id, err := strconv.Atoi(string(data))
+	if err != nil || id < 0 {
+		return 0, errInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"scalable-task-api/internal/authz"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+var (
+	errNoFieldsToUpdate   = errors.New("no fields to update")
+	errBulkDataRequired   = errors.New("data is required")
+	errInvalidParent      = errors.New("parent task not found in project")
+	errParentCycle        = errors.New("parent task is the task or one of its subtasks")
+	errActualHoursDerived = errors.New("actual hours are derived from work logs")
+)
+
+// isForeignKeyViolation reports whether err is a Postgres foreign key violation
+func isForeignKeyViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23503"
+}
+
+// isUnknownRole reports whether err is a violation of the foreign keys tying
+// users and project members to roles, as when a role is deleted while being
+// given to someone
+func isUnknownRole(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23503" &&
+		(pqErr.Constraint == "users_role_fkey" || pqErr.Constraint == "project_members_role_fkey")
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// respondAuthzError maps an authorization error to an HTTP response. Resources
+// the caller cannot see are reported as not found.
+func respondAuthzError(c *gin.Context, err error, resource string) {
+	switch err {
+	case authz.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": resource + " not found"})
+	case authz.ErrForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize request"})
+	}
+}
+
+// currentSubject returns the authenticated caller, writing a 401 response if there is none
+func currentSubject(c *gin.Context) (authz.Subject, bool) {
+	subject, ok := authz.SubjectFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	}
+	return subject, ok
+}
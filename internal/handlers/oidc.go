@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"scalable-task-api/internal/auth"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcLoginTTL is how long a user has to sign in at the identity provider
+const oidcLoginTTL = "10 minutes"
+
+// errOIDCNoEmail is returned for new single sign-on users without an email address
+var errOIDCNoEmail = errors.New("the identity provider did not return an email address")
+
+// errOIDCEmailTaken is returned for new single sign-on users whose email
+// address belongs to an existing account that cannot be linked automatically
+var errOIDCEmailTaken = errors.New("an account with this email address already exists")
+
+// errOIDCIdentityLinked is returned when linking an identity that already
+// belongs to another account
+var errOIDCIdentityLinked = errors.New("the identity is linked to another account")
+
+// OIDCLogin starts a single sign-on login
+// @Summary Start single sign-on
+// @Description Redirect to the OpenID Connect identity provider to sign in. The provider redirects back to /auth/oidc/callback, which returns the tokens.
+// @Tags auth
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oidc/login [get]
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if authURL, ok := h.startOIDCLogin(c, nil); ok {
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// OIDCLink starts linking a single sign-on identity to the current account
+// @Summary Link single sign-on identity
+// @Description Start a single sign-on login that links the identity to the authenticated account instead of matching it by email address. Send the user to the returned URL; the provider redirects back to /auth/oidc/callback, which returns tokens as for a login. The account's role follows the identity provider from then on.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oidc/link [post]
+func (h *AuthHandler) OIDCLink(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+	// A leaked API key must not be turned into a login for its user
+	if subject.Scope != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Single sign-on cannot be linked with an API key"})
+		return
+	}
+
+	if authURL, ok := h.startOIDCLogin(c, &subject.UserID); ok {
+		c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+	}
+}
+
+// startOIDCLogin records a new login, linking to userID when it is set, and
+// returns the identity provider URL to send the user to. It writes an error
+// response and returns false if the login cannot be started.
+func (h *AuthHandler) startOIDCLogin(c *gin.Context, userID *int) (string, bool) {
+	if h.oidc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled"})
+		return "", false
+	}
+
+	login, err := auth.NewOIDCLogin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return "", false
+	}
+
+	authURL, err := h.oidc.AuthCodeURL(c.Request.Context(), login)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return "", false
+	}
+
+	// Logins that were never finished are cleaned up as new ones start
+	if _, err := h.db.Exec(`DELETE FROM oidc_logins WHERE expires_at < NOW()`); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return "", false
+	}
+	_, err = h.db.Exec(`
+		INSERT INTO oidc_logins (state, nonce, code_verifier, user_id, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + INTERVAL '`+oidcLoginTTL+`')
+	`, login.State, login.Nonce, login.CodeVerifier, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return "", false
+	}
+
+	return authURL, true
+}
+
+// OIDCCallback finishes a single sign-on login
+// @Summary Finish single sign-on
+// @Description Redeem the authorization code the identity provider redirected back with and return tokens. Users are created on their first login, and their role is set from their groups on every login. An existing account is only linked by email address when the provider verified the address and the account's own address is verified or it has no password; other accounts must link through /auth/oidc/link.
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State of the login"
+// @Success 200 {object} auth.TokenResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oidc/callback [get]
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.oidc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not enabled"})
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		message := "Single sign-on failed: " + providerError
+		if description := c.Query("error_description"); description != "" {
+			message += ": " + description
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required"})
+		return
+	}
+
+	// Each login can be finished once
+	login := auth.OIDCLogin{State: state}
+	var linkUserID *int
+	var pending bool
+	err := h.db.QueryRow(`
+		DELETE FROM oidc_logins
+		WHERE state = $1
+		RETURNING nonce, code_verifier, user_id, expires_at > NOW()
+	`, state).Scan(&login.Nonce, &login.CodeVerifier, &linkUserID, &pending)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finish login"})
+		return
+	}
+	if err == sql.ErrNoRows || !pending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or expired login"})
+		return
+	}
+
+	identity, err := h.oidc.Exchange(c.Request.Context(), code, &login)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCRejected) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Single sign-on failed"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	role := h.oidc.Role(identity.Groups)
+	userID, username, err := h.provisionOIDCUser(identity, role, linkUserID)
+	if err != nil {
+		switch err {
+		case errOIDCNoEmail:
+			c.JSON(http.StatusForbidden, gin.H{"error": "The identity provider did not return an email address"})
+		case errOIDCEmailTaken:
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email address already exists; sign in to it and link single sign-on from there"})
+		case errOIDCIdentityLinked:
+			c.JSON(http.StatusConflict, gin.H{"error": "This identity is already linked to another account"})
+		case sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			if isUnknownRole(err) {
+				log.Printf("Single sign-on gives role %q, which no longer exists", role)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in user"})
+		}
+		return
+	}
+
+	h.startSession(c, userID, username, role)
+}
+
+// provisionOIDCUser returns the user signed in as an identity, creating them
+// on their first login. A new identity is linked to linkUserID when it is
+// set, and otherwise to the account with its email address if linkOIDCUser
+// allows it. The user's role and name follow the identity provider, and a
+// verified email address matching the account's verifies it.
+func (h *AuthHandler) provisionOIDCUser(identity *auth.OIDCIdentity, role string, linkUserID *int) (int, string, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var username string
+	err = tx.QueryRow(`
+		SELECT u.id, u.username
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2
+		FOR UPDATE OF i
+	`, identity.Issuer, identity.Subject).Scan(&userID, &username)
+	switch {
+	case err == sql.ErrNoRows && linkUserID != nil:
+		userID = *linkUserID
+		if err := tx.QueryRow(`SELECT username FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&username); err != nil {
+			return 0, "", err
+		}
+		if err := insertIdentity(tx, userID, identity); err != nil {
+			return 0, "", err
+		}
+	case err == sql.ErrNoRows:
+		if userID, username, err = linkOIDCUser(tx, identity); err != nil {
+			return 0, "", err
+		}
+	case err != nil:
+		return 0, "", err
+	case linkUserID != nil && *linkUserID != userID:
+		return 0, "", errOIDCIdentityLinked
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET role = $2, full_name = COALESCE(NULLIF($3, ''), full_name),
+		    email_verified = email_verified OR ($5 AND lower(email) = lower($4)),
+		    updated_at = NOW()
+		WHERE id = $1
+	`, userID, role, identity.Name, identity.Email, identity.EmailVerified)
+	if err != nil {
+		return 0, "", err
+	}
+	_, err = tx.Exec(`
+		UPDATE user_identities SET last_login_at = NOW()
+		WHERE issuer = $1 AND subject = $2
+	`, identity.Issuer, identity.Subject)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+	return userID, username, nil
+}
+
+// linkOIDCUser links a new identity to the account with its email address,
+// or to a new account. An existing account is only linked when the provider
+// verified the address and the account's own address was verified or it has
+// no password; otherwise anyone could claim an address before its owner first
+// signs in and so take over their single sign-on login.
+func linkOIDCUser(tx *sql.Tx, identity *auth.OIDCIdentity) (int, string, error) {
+	if identity.Email == "" {
+		return 0, "", errOIDCNoEmail
+	}
+
+	var userID int
+	var username string
+	var linkable bool
+	err := tx.QueryRow(`
+		SELECT id, username, email_verified OR password_hash = ''
+		FROM users WHERE lower(email) = lower($1)
+		FOR UPDATE
+	`, identity.Email).Scan(&userID, &username, &linkable)
+	switch {
+	case err == nil && (!identity.EmailVerified || !linkable):
+		return 0, "", errOIDCEmailTaken
+	case err == sql.ErrNoRows:
+		if username, err = freeUsername(tx, identity); err != nil {
+			return 0, "", err
+		}
+		err = tx.QueryRow(`
+			INSERT INTO users (username, email, password_hash, full_name, role, email_verified)
+			VALUES ($1, $2, '', NULLIF($3, ''), 'user', $4)
+			RETURNING id
+		`, username, identity.Email, identity.Name, identity.EmailVerified).Scan(&userID)
+		if isUniqueViolation(err) {
+			return 0, "", errOIDCEmailTaken
+		}
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	if err := insertIdentity(tx, userID, identity); err != nil {
+		return 0, "", err
+	}
+	return userID, username, nil
+}
+
+// insertIdentity links identity to a user
+func insertIdentity(tx *sql.Tx, userID int, identity *auth.OIDCIdentity) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject)
+		VALUES ($1, $2, $3)
+	`, userID, identity.Issuer, identity.Subject)
+	return err
+}
+
+// freeUsername returns an unused username for a new single sign-on user,
+// based on their preferred username or email address
+func freeUsername(tx *sql.Tx, identity *auth.OIDCIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if runes := []rune(base); len(runes) > 40 {
+		base = string(runes[:40])
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	for i := 1; ; i++ {
+		candidate := base
+		if i > 1 {
+			candidate += strconv.Itoa(i)
+		}
+
+		var taken bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`, candidate).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
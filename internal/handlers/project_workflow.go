@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+var workflowStatusPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// statusError reports a task status the project's workflow does not allow
+type statusError struct {
+	message string
+	allowed []string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// respondStatusError writes the 422 for a rejected status, listing the
+// statuses that would have been accepted
+func respondStatusError(c *gin.Context, err *statusError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.message, "allowed_statuses": err.allowed})
+}
+
+// loadWorkflow returns the workflow of a project, or sql.ErrNoRows if the
+// project does not exist. With lock set, the project row is share-locked so
+// the workflow cannot change before the caller's transaction ends.
+func loadWorkflow(q rowQuerier, projectID int, lock bool) (models.Workflow, error) {
+	query := `
+		SELECT w.initial_status, w.statuses, w.completed_statuses, w.transitions, w.updated_at
+		FROM projects p
+		LEFT JOIN project_workflows w ON w.project_id = p.id
+		WHERE p.id = $1`
+	if lock {
+		query += " FOR SHARE OF p"
+	}
+
+	var initialStatus sql.NullString
+	var statuses, completedStatuses pq.StringArray
+	var transitions []byte
+	var updatedAt *time.Time
+	if err := q.QueryRow(query, projectID).Scan(&initialStatus, &statuses, &completedStatuses, &transitions, &updatedAt); err != nil {
+		return models.Workflow{}, err
+	}
+
+	if !initialStatus.Valid {
+		return models.DefaultWorkflow(projectID), nil
+	}
+
+	workflow := models.Workflow{
+		ProjectID:         projectID,
+		InitialStatus:     initialStatus.String,
+		Statuses:          statuses,
+		CompletedStatuses: completedStatuses,
+		UpdatedAt:         updatedAt,
+	}
+	if err := json.Unmarshal(transitions, &workflow.Transitions); err != nil {
+		return models.Workflow{}, err
+	}
+	return workflow, nil
+}
+
+// validateWorkflow checks that a workflow only refers to its own statuses and
+// fills in the default completed statuses
+func validateWorkflow(req *models.UpdateWorkflowRequest) string {
+	seen := make(map[string]bool, len(req.Statuses))
+	for _, status := range req.Statuses {
+		if !workflowStatusPattern.MatchString(status) {
+			return "Invalid status name: " + status
+		}
+		if seen[status] {
+			return "Duplicate status: " + status
+		}
+		seen[status] = true
+	}
+
+	if !seen[req.InitialStatus] {
+		return "Initial status must be one of the workflow statuses"
+	}
+
+	if req.CompletedStatuses == nil && seen[string(models.TaskStatusDone)] {
+		req.CompletedStatuses = []string{string(models.TaskStatusDone)}
+	}
+	if len(req.CompletedStatuses) == 0 {
+		return "completed_statuses is required when the workflow has no done status"
+	}
+	completed := make(map[string]bool, len(req.CompletedStatuses))
+	for _, status := range req.CompletedStatuses {
+		if !seen[status] {
+			return "Completed status must be one of the workflow statuses: " + status
+		}
+		if completed[status] {
+			return "Duplicate completed status: " + status
+		}
+		completed[status] = true
+	}
+
+	for from, targets := range req.Transitions {
+		if !seen[from] {
+			return "Transition from unknown status: " + from
+		}
+		for _, to := range targets {
+			if !seen[to] {
+				return "Transition to unknown status: " + to
+			}
+		}
+	}
+
+	return ""
+}
+
+// GetWorkflow retrieves the task workflow of a project
+// @Summary Get project workflow
+// @Description Get the task statuses of a project and the status changes allowed between them
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Workflow
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /projects/{id}/workflow [get]
+func (h *ProjectHandler) GetWorkflow(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if err := h.authz.RequireProject(subject, id, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	workflow, err := loadWorkflow(h.db, id, false)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get workflow"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
+
+// UpdateWorkflow replaces the task workflow of a project
+// @Summary Update project workflow
+// @Description Replace the task statuses and allowed transitions of a project (owner or admin only). Statuses still used by tasks in the project cannot be removed. Tasks in the completed statuses (done unless given) count as completed; changing them completes or reopens existing tasks to match.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param request body models.UpdateWorkflowRequest true "Workflow definition"
+// @Success 200 {object} models.Workflow
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
+// @Router /projects/{id}/workflow [put]
+func (h *ProjectHandler) UpdateWorkflow(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if err := h.authz.RequireProject(subject, id, authz.AccessOwner); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	var req models.UpdateWorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := validateWorkflow(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Block task writes in the project while the statuses are checked and replaced
+	if _, err := tx.Exec(`SELECT id FROM projects WHERE id = $1 FOR UPDATE`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+
+	rows, err := tx.Query(`
+		SELECT DISTINCT status FROM tasks
+		WHERE project_id = $1 AND status <> ALL($2)
+		ORDER BY status
+	`, id, pq.Array(req.Statuses))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+	inUse := []string{}
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+			return
+		}
+		inUse = append(inUse, status)
+	}
+	rows.Close()
+
+	if len(inUse) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Tasks in this project use statuses missing from the workflow",
+			"statuses": inUse,
+		})
+		return
+	}
+
+	transitions, err := json.Marshal(req.Transitions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO project_workflows (project_id, initial_status, statuses, completed_statuses, transitions, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (project_id) DO UPDATE
+		SET initial_status = EXCLUDED.initial_status, statuses = EXCLUDED.statuses,
+		    completed_statuses = EXCLUDED.completed_statuses,
+		    transitions = EXCLUDED.transitions, updated_at = EXCLUDED.updated_at
+	`, id, req.InitialStatus, pq.Array(req.Statuses), pq.Array(req.CompletedStatuses), transitions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+
+	// Tasks whose status became or stopped being a completed one are
+	// completed or reopened, so completed_at keeps matching the workflow
+	_, err = tx.Exec(`
+		UPDATE tasks
+		SET completed_at = CASE WHEN status = ANY($2) THEN NOW() END, updated_at = NOW()
+		WHERE project_id = $1 AND (status = ANY($2)) <> (completed_at IS NOT NULL)
+	`, id, pq.Array(req.CompletedStatuses))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+
+	workflow, err := loadWorkflow(tx, id, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workflow"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workflow)
+}
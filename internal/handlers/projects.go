@@ -0,0 +1,645 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"scalable-task-api/internal/storage"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const projectColumns = `id, name, COALESCE(description, ''), COALESCE(owner_id, 0), status, created_at, updated_at`
+
+// ProjectHandler handles project-related endpoints
+type ProjectHandler struct {
+	db    *sql.DB
+	authz *authz.Authorizer
+	blobs storage.BlobStore
+}
+
+// NewProjectHandler creates a new project handler
+func NewProjectHandler(db *sql.DB, authorizer *authz.Authorizer, blobs storage.BlobStore) *ProjectHandler {
+	return &ProjectHandler{
+		db:    db,
+		authz: authorizer,
+		blobs: blobs,
+	}
+}
+
+// CreateProject creates a new project
+// @Summary Create a new project
+// @Description Create a new project. The owner defaults to the authenticated user; only admins may create projects for someone else.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateProjectRequest true "Project information"
+// @Success 201 {object} models.Project
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /projects [post]
+func (h *ProjectHandler) CreateProject(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerID := subject.UserID
+	if req.OwnerID != nil {
+		ownerID = *req.OwnerID
+	}
+
+	if ownerID != subject.UserID && !subject.IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		return
+	}
+
+	if ok, err := h.userExists(ownerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate owner"})
+		return
+	} else if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Owner not found"})
+		return
+	}
+
+	if req.Status == "" {
+		req.Status = string(models.ProjectStatusActive)
+	}
+
+	var project models.Project
+	err := h.db.QueryRow(`
+		INSERT INTO projects (name, description, owner_id, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+projectColumns,
+		req.Name, req.Description, ownerID, req.Status,
+	).Scan(
+		&project.ID, &project.Name, &project.Description, &project.OwnerID,
+		&project.Status, &project.CreatedAt, &project.UpdatedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, project)
+}
+
+// GetProjects retrieves projects with filtering and pagination
+// @Summary Get projects
+// @Description Get the projects the caller owns or is a member of, with optional filtering by status and owner
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Param status query []string false "Filter by status"
+// @Param owner_id query int false "Filter by owner ID"
+// @Param limit query int false "Limit results (at most 200)" default(50)
+// @Param offset query int false "Offset results" default(0)
+// @Success 200 {array} models.Project
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /projects [get]
+func (h *ProjectHandler) GetProjects(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var query models.ProjectQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit == 0 {
+		query.Limit = 50
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	if len(query.Status) > 0 {
+		args = append(args, pq.Array(query.Status))
+		conditions = append(conditions, "status = ANY($"+strconv.Itoa(len(args))+")")
+	}
+
+	if query.OwnerID != nil {
+		args = append(args, *query.OwnerID)
+		conditions = append(conditions, "owner_id = $"+strconv.Itoa(len(args)))
+	}
+
+	if condition, conditionArgs := h.authz.VisibleProjectsCondition(subject, "id", len(args)+1); condition != "" {
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	queryStr := `SELECT ` + projectColumns + ` FROM projects` + whereClause +
+		` ORDER BY created_at DESC, id DESC LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	args = append(args, query.Limit, query.Offset)
+
+	rows, err := h.db.Query(queryStr, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query projects"})
+		return
+	}
+	defer rows.Close()
+
+	projects := []models.Project{}
+	for rows.Next() {
+		var project models.Project
+		err := rows.Scan(
+			&project.ID, &project.Name, &project.Description, &project.OwnerID,
+			&project.Status, &project.CreatedAt, &project.UpdatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan project"})
+			return
+		}
+		projects = append(projects, project)
+	}
+
+	c.JSON(http.StatusOK, projects)
+}
+
+// GetProject retrieves a single project by ID
+// @Summary Get project by ID
+// @Description Get a single project by its ID
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /projects/{id} [get]
+func (h *ProjectHandler) GetProject(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if err := h.authz.RequireProject(subject, id, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	var project models.Project
+	err = h.db.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE id = $1`, id).Scan(
+		&project.ID, &project.Name, &project.Description, &project.OwnerID,
+		&project.Status, &project.CreatedAt, &project.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+// UpdateProject updates an existing project
+// @Summary Update project
+// @Description Update an existing project (owner or admin only)
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param request body models.UpdateProjectRequest true "Project update information"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /projects/{id} [put]
+func (h *ProjectHandler) UpdateProject(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if err := h.authz.RequireProject(subject, id, authz.AccessOwner); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	var req models.UpdateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.OwnerID != nil {
+		if ok, err := h.userExists(*req.OwnerID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate owner"})
+			return
+		} else if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Owner not found"})
+			return
+		}
+	}
+
+	updateClause, args := h.buildProjectUpdateClause(req)
+	if len(args) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	query := `
+		UPDATE projects SET ` + updateClause + `, updated_at = NOW()
+		WHERE id = $` + strconv.Itoa(len(args)+1) + `
+		RETURNING ` + projectColumns
+	args = append(args, id)
+
+	var project models.Project
+	err = h.db.QueryRow(query, args...).Scan(
+		&project.ID, &project.Name, &project.Description, &project.OwnerID,
+		&project.Status, &project.CreatedAt, &project.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+// DeleteProject deletes a project
+// @Summary Delete project
+// @Description Delete a project by ID (owner or admin only). Projects that still have tasks are only deleted when cascade=true.
+// @Tags projects
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param cascade query bool false "Also delete the project's tasks" default(false)
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
+// @Router /projects/{id} [delete]
+func (h *ProjectHandler) DeleteProject(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if err := h.authz.RequireProject(subject, id, authz.AccessOwner); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	cascade, err := strconv.ParseBool(c.DefaultQuery("cascade", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cascade value"})
+		return
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the project row so no task can be attached while we delete it
+	var exists bool
+	err = tx.QueryRow(`SELECT TRUE FROM projects WHERE id = $1 FOR UPDATE`, id).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+
+	var taskCount int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE project_id = $1`, id).Scan(&taskCount); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+
+	var blobs pq.StringArray
+	if taskCount > 0 {
+		if !cascade {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "Project still has tasks; delete them first or pass cascade=true",
+				"task_count": taskCount,
+			})
+			return
+		}
+		err := tx.QueryRow(`
+			SELECT COALESCE(array_agg(DISTINCT a.blob_hash), '{}')
+			FROM task_attachments a
+			JOIN tasks t ON t.id = a.task_id
+			WHERE t.project_id = $1
+		`, id).Scan(&blobs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project tasks"})
+			return
+		}
+		if _, err := tx.Exec(`DELETE FROM tasks WHERE project_id = $1`, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project tasks"})
+			return
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM task_metrics WHERE project_id = $1`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project metrics"})
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM projects WHERE id = $1`, id); err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Project is still referenced by other records"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+
+	// Remove attachment content no other task uses
+	collectBlobs(h.db, h.blobs, blobs)
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetProjectMembers lists the members of a project
+// @Summary Get project members
+// @Description List the users who have been granted access to a project
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.ProjectMember
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /projects/{id}/members [get]
+func (h *ProjectHandler) GetProjectMembers(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if err := h.authz.RequireProject(subject, id, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT m.project_id, m.user_id, u.username, COALESCE(u.full_name, ''), m.role, m.created_at
+		FROM project_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.project_id = $1
+		ORDER BY u.username
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query project members"})
+		return
+	}
+	defer rows.Close()
+
+	members := []models.ProjectMember{}
+	for rows.Next() {
+		var member models.ProjectMember
+		err := rows.Scan(
+			&member.ProjectID, &member.UserID, &member.Username, &member.FullName,
+			&member.Role, &member.CreatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan project member"})
+			return
+		}
+		members = append(members, member)
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// AddProjectMember adds a member to a project or changes their role
+// @Summary Add project member
+// @Description Give a user a role in a project, such as "viewer" for read access, "member" for read/write access or "maintainer" to also manage the project. The role's project permissions apply in the project (owner or admin only).
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param request body models.AddProjectMemberRequest true "Member information"
+// @Success 200 {object} models.ProjectMember
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /projects/{id}/members [post]
+func (h *ProjectHandler) AddProjectMember(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req models.AddProjectMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = authz.MemberRoleMember
+	}
+
+	if err := h.authz.RequireProject(subject, id, authz.AccessOwner); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	// Project owners have every project permission, so they may give any role
+	if !checkRole(c, h.db, nil, req.Role) {
+		return
+	}
+
+	var member models.ProjectMember
+	err = h.db.QueryRow(`
+		WITH upserted AS (
+			INSERT INTO project_members (project_id, user_id, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (project_id, user_id) DO UPDATE SET role = EXCLUDED.role
+			RETURNING project_id, user_id, role, created_at
+		)
+		SELECT m.project_id, m.user_id, u.username, COALESCE(u.full_name, ''), m.role, m.created_at
+		FROM upserted m
+		JOIN users u ON u.id = m.user_id
+	`, id, req.UserID, req.Role).Scan(
+		&member.ProjectID, &member.UserID, &member.Username, &member.FullName,
+		&member.Role, &member.CreatedAt,
+	)
+	if err != nil {
+		if isUnknownRole(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + req.Role})
+			return
+		}
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add project member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveProjectMember removes a member from a project
+// @Summary Remove project member
+// @Description Revoke a user's access to a project. Owners and admins can remove anyone; members can remove themselves.
+// @Tags projects
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param user_id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /projects/{id}/members/{user_id} [delete]
+func (h *ProjectHandler) RemoveProjectMember(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	need := authz.AccessOwner
+	if userID == subject.UserID {
+		need = authz.AccessRead
+	}
+	if err := h.authz.RequireProject(subject, id, need); err != nil {
+		respondAuthzError(c, err, "Project")
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM project_members WHERE project_id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove project member"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project member not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Helper functions
+
+func (h *ProjectHandler) userExists(userID int) (bool, error) {
+	var exists bool
+	err := h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists)
+	return exists, err
+}
+
+func (h *ProjectHandler) buildProjectUpdateClause(req models.UpdateProjectRequest) (string, []interface{}) {
+	var setParts []string
+	var args []interface{}
+
+	if req.Name != nil {
+		args = append(args, *req.Name)
+		setParts = append(setParts, "name = $"+strconv.Itoa(len(args)))
+	}
+
+	if req.Description != nil {
+		args = append(args, *req.Description)
+		setParts = append(setParts, "description = $"+strconv.Itoa(len(args)))
+	}
+
+	if req.OwnerID != nil {
+		args = append(args, *req.OwnerID)
+		setParts = append(setParts, "owner_id = $"+strconv.Itoa(len(args)))
+	}
+
+	if req.Status != nil {
+		args = append(args, *req.Status)
+		setParts = append(setParts, "status = $"+strconv.Itoa(len(args)))
+	}
+
+	return strings.Join(setParts, ", "), args
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"scalable-task-api/internal/recurrence"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upcomingOccurrences is how many future occurrences a recurrence lists
+const upcomingOccurrences = 5
+
+const recurrenceColumns = `id, template_task_id, rrule, starts_at, timezone, next_at, last_error,
+	created_by, created_at, updated_at`
+
+// recurrenceScanFields returns the scan destinations matching recurrenceColumns
+func recurrenceScanFields(rec *models.TaskRecurrence) []interface{} {
+	return []interface{}{
+		&rec.ID, &rec.TemplateTaskID, &rec.RRule, &rec.StartsAt, &rec.Timezone, &rec.NextAt, &rec.LastError,
+		&rec.CreatedBy, &rec.CreatedAt, &rec.UpdatedAt,
+	}
+}
+
+// RecurrenceHandler handles recurring task endpoints. The tasks themselves
+// are created by recurrence.Scheduler.
+type RecurrenceHandler struct {
+	db    *sql.DB
+	authz *authz.Authorizer
+}
+
+// NewRecurrenceHandler creates a new recurrence handler
+func NewRecurrenceHandler(db *sql.DB, authorizer *authz.Authorizer) *RecurrenceHandler {
+	return &RecurrenceHandler{
+		db:    db,
+		authz: authorizer,
+	}
+}
+
+// GetRecurrence retrieves the schedule of a recurring template task
+// @Summary Get task recurrence
+// @Description Get the recurrence schedule of a template task with its next few occurrences
+// @Tags recurrences
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template task ID"
+// @Success 200 {object} models.TaskRecurrence
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/recurrence [get]
+func (h *RecurrenceHandler) GetRecurrence(c *gin.Context) {
+	taskID, ok := h.templateParam(c, authz.AccessRead)
+	if !ok {
+		return
+	}
+
+	var rec models.TaskRecurrence
+	err := h.db.QueryRow(`SELECT `+recurrenceColumns+` FROM task_recurrences WHERE template_task_id = $1`, taskID).
+		Scan(recurrenceScanFields(&rec)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task does not recur"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get recurrence"})
+		return
+	}
+
+	withUpcoming(&rec)
+	c.JSON(http.StatusOK, rec)
+}
+
+// SetRecurrence makes a task a recurring template or replaces its schedule
+// @Summary Set task recurrence
+// @Description Make a task repeat on an iCalendar RRULE schedule. Each occurrence creates a copy of the task (title, description, priority, assignee, parent, estimate and tags) in the project's initial status, due at the occurrence. Occurrences before now are not created, and occurrences missed while the scheduler was down are skipped rather than created late. Supported rule parts are FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH.
+// @Tags recurrences
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template task ID"
+// @Param request body models.SetTaskRecurrenceRequest true "Schedule"
+// @Success 200 {object} models.TaskRecurrence
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/recurrence [put]
+func (h *RecurrenceHandler) SetRecurrence(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, ok := h.templateParam(c, authz.AccessWrite)
+	if !ok {
+		return
+	}
+
+	var req models.SetTaskRecurrenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(req.Timezone)
+	if err != nil || req.Timezone == "Local" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone: " + req.Timezone})
+		return
+	}
+
+	rule, err := recurrence.Parse(req.RRule, req.StartsAt.In(loc))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rrule: " + err.Error()})
+		return
+	}
+
+	// Schedules starting in the past pick up from now rather than catching up
+	after := time.Now()
+	if rule.Start().After(after) {
+		after = rule.Start().Add(-time.Second)
+	}
+	var nextAt *time.Time
+	if next, ok := rule.Next(after); ok {
+		nextAt = &next
+	}
+
+	var rec models.TaskRecurrence
+	err = h.db.QueryRow(`
+		INSERT INTO task_recurrences (template_task_id, rrule, starts_at, timezone, next_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (template_task_id) DO UPDATE SET
+			rrule = EXCLUDED.rrule,
+			starts_at = EXCLUDED.starts_at,
+			timezone = EXCLUDED.timezone,
+			next_at = EXCLUDED.next_at,
+			last_error = NULL,
+			updated_at = NOW()
+		RETURNING `+recurrenceColumns,
+		taskID, req.RRule, rule.Start(), req.Timezone, nextAt, subject.UserID,
+	).Scan(recurrenceScanFields(&rec)...)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set recurrence"})
+		return
+	}
+
+	withUpcoming(&rec)
+	c.JSON(http.StatusOK, rec)
+}
+
+// DeleteRecurrence stops a task from recurring
+// @Summary Delete task recurrence
+// @Description Stop a template task from recurring. Tasks already created for past occurrences are kept.
+// @Tags recurrences
+// @Security BearerAuth
+// @Param id path int true "Template task ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/recurrence [delete]
+func (h *RecurrenceHandler) DeleteRecurrence(c *gin.Context) {
+	taskID, ok := h.templateParam(c, authz.AccessWrite)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM task_recurrences WHERE template_task_id = $1`, taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurrence"})
+		return
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task does not recur"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetOccurrences lists the tasks created from a recurring template
+// @Summary Get task occurrences
+// @Description Get the occurrences of a recurring template task that have been created, newest first. task_id is null once the created task is deleted.
+// @Tags recurrences
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template task ID"
+// @Param limit query int false "Limit results" default(50)
+// @Success 200 {array} models.TaskOccurrence
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/occurrences [get]
+func (h *RecurrenceHandler) GetOccurrences(c *gin.Context) {
+	taskID, ok := h.templateParam(c, authz.AccessRead)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	rows, err := h.db.Query(`
+		SELECT o.occurrence_at, o.task_id, o.created_at
+		FROM task_occurrences o
+		JOIN task_recurrences r ON r.id = o.recurrence_id
+		WHERE r.template_task_id = $1
+		ORDER BY o.occurrence_at DESC
+		LIMIT $2
+	`, taskID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query occurrences"})
+		return
+	}
+	defer rows.Close()
+
+	occurrences := []models.TaskOccurrence{}
+	for rows.Next() {
+		var occurrence models.TaskOccurrence
+		if err := rows.Scan(&occurrence.OccurrenceAt, &occurrence.TaskID, &occurrence.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan occurrence"})
+			return
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	c.JSON(http.StatusOK, occurrences)
+}
+
+// templateParam parses the template task ID and checks the caller's access
+// to it, writing the error response if either fails
+func (h *RecurrenceHandler) templateParam(c *gin.Context, need authz.Access) (int, bool) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return 0, false
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return 0, false
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, need); err != nil {
+		respondAuthzError(c, err, "Task")
+		return 0, false
+	}
+
+	return taskID, true
+}
+
+// withUpcoming fills in the next occurrences of rec, starting at next_at
+func withUpcoming(rec *models.TaskRecurrence) {
+	rec.Upcoming = []time.Time{}
+	if rec.NextAt == nil {
+		return
+	}
+
+	loc, err := time.LoadLocation(rec.Timezone)
+	if err != nil {
+		return
+	}
+	rule, err := recurrence.Parse(rec.RRule, rec.StartsAt.In(loc))
+	if err != nil {
+		return
+	}
+
+	next := rec.NextAt.In(loc)
+	rec.Upcoming = append(rec.Upcoming, next)
+	rec.Upcoming = append(rec.Upcoming, rule.Upcoming(next, upcomingOccurrences-1)...)
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// adminRole is the built-in role with every permission. It cannot be changed,
+// so admins cannot lock themselves out.
+const adminRole = "admin"
+
+const roleColumns = `name, description, permissions, builtin, created_at, updated_at`
+
+// roleScanFields returns the scan destinations matching roleColumns
+func roleScanFields(role *models.Role) []interface{} {
+	return []interface{}{
+		&role.Name, &role.Description, pq.Array(&role.Permissions), &role.Builtin, &role.CreatedAt, &role.UpdatedAt,
+	}
+}
+
+// RoleHandler handles role endpoints
+type RoleHandler struct {
+	db    *sql.DB
+	authz *authz.Authorizer
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(db *sql.DB, authorizer *authz.Authorizer) *RoleHandler {
+	return &RoleHandler{
+		db:    db,
+		authz: authorizer,
+	}
+}
+
+// GetPermissions lists the permissions roles can grant
+// @Summary Get permissions
+// @Description List the permissions roles can grant
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} authz.Permission
+// @Failure 401 {object} map[string]string
+// @Router /permissions [get]
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, authz.AllPermissions)
+}
+
+// GetRoles lists roles
+// @Summary Get roles
+// @Description List the roles users and project members can be given
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Role
+// @Failure 401 {object} map[string]string
+// @Router /roles [get]
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	rows, err := h.db.Query(`SELECT ` + roleColumns + ` FROM roles ORDER BY name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query roles"})
+		return
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(roleScanFields(&role)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan role"})
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRole retrieves a role by name
+// @Summary Get role
+// @Description Get a role and its permissions
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Role name"
+// @Success 200 {object} models.Role
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /roles/{name} [get]
+func (h *RoleHandler) GetRole(c *gin.Context) {
+	var role models.Role
+	err := h.db.QueryRow(`SELECT `+roleColumns+` FROM roles WHERE name = $1`, c.Param("name")).Scan(roleScanFields(&role)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole creates a role
+// @Summary Create role
+// @Description Create a role granting a set of permissions, which the caller must have themselves (role:admin permission required)
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateRoleRequest true "Role information"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /roles [post]
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permissions, ok := validPermissions(c, subject, req.Permissions)
+	if !ok {
+		return
+	}
+
+	var role models.Role
+	err := h.db.QueryRow(`
+		INSERT INTO roles (name, description, permissions)
+		VALUES ($1, $2, $3)
+		RETURNING `+roleColumns,
+		req.Name, req.Description, pq.Array(permissions),
+	).Scan(roleScanFields(&role)...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	h.authz.InvalidateRoles()
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole updates a role
+// @Summary Update role
+// @Description Change a role's description or permissions. Users with the role get the new permissions on their next request. The admin role cannot be changed (role:admin permission required).
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param name path string true "Role name"
+// @Param request body models.UpdateRoleRequest true "Role updates"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /roles/{name} [put]
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+	if name == adminRole {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The admin role cannot be changed"})
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var setParts []string
+	var args []interface{}
+	argIndex := 1
+
+	if req.Description != nil {
+		setParts = append(setParts, "description = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.Description)
+		argIndex++
+	}
+
+	if req.Permissions != nil {
+		permissions, ok := validPermissions(c, subject, req.Permissions)
+		if !ok {
+			return
+		}
+		setParts = append(setParts, "permissions = $"+strconv.Itoa(argIndex))
+		args = append(args, pq.Array(permissions))
+		argIndex++
+	}
+
+	if len(setParts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	setParts = append(setParts, "updated_at = NOW()")
+	args = append(args, name)
+
+	var role models.Role
+	err := h.db.QueryRow(`
+		UPDATE roles SET `+strings.Join(setParts, ", ")+`
+		WHERE name = $`+strconv.Itoa(argIndex)+`
+		RETURNING `+roleColumns,
+		args...,
+	).Scan(roleScanFields(&role)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	h.authz.InvalidateRoles()
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes a role
+// @Summary Delete role
+// @Description Delete a role that no user or project member has. Built-in roles cannot be deleted (role:admin permission required).
+// @Tags roles
+// @Security BearerAuth
+// @Param name path string true "Role name"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /roles/{name} [delete]
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the role. Giving someone a role checks the foreign keys on
+	// users.role and project_members.role, which waits for the lock and then
+	// fails once the role is gone.
+	var builtin bool
+	err = tx.QueryRow(`SELECT builtin FROM roles WHERE name = $1 FOR UPDATE`, name).Scan(&builtin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if builtin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)
+			OR EXISTS (SELECT 1 FROM project_members WHERE role = $1)
+	`, name).Scan(&inUse)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still given to users or project members"})
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM roles WHERE name = $1`, name); err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Role is still given to users or project members"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	h.authz.InvalidateRoles()
+
+	c.Status(http.StatusNoContent)
+}
+
+// validPermissions checks that every permission exists and that the subject
+// has it, so nobody can grant more than they have, and removes duplicates. It
+// writes the error response if not.
+func validPermissions(c *gin.Context, subject authz.Subject, permissions []string) ([]string, bool) {
+	seen := map[string]bool{}
+	valid := []string{}
+	for _, permission := range permissions {
+		if !authz.ValidPermission(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + permission})
+			return nil, false
+		}
+		if !subject.Permissions.Has(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot grant a permission you do not have: " + permission})
+			return nil, false
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			valid = append(valid, permission)
+		}
+	}
+	return valid, true
+}
+
+// checkRole checks that a role exists and, if subject is not nil, that the
+// subject has every permission it grants, so nobody can give a user more than
+// they have. It writes the error response if not.
+func checkRole(c *gin.Context, db *sql.DB, subject *authz.Subject, name string) bool {
+	var permissions []string
+	err := db.QueryRow(`SELECT permissions FROM roles WHERE name = $1`, name).Scan(pq.Array(&permissions))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + name})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role"})
+		return false
+	}
+
+	if subject != nil && !hasPermissions(*subject, permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot give a role with permissions you do not have"})
+		return false
+	}
+	return true
+}
+
+// hasPermissions reports whether the subject has every one of permissions
+func hasPermissions(subject authz.Subject, permissions []string) bool {
+	for _, permission := range permissions {
+		if !subject.Permissions.Has(permission) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"scalable-task-api/internal/auth"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"scalable-task-api/internal/stream"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// streamHeartbeat keeps idle streams from being closed by proxies
+	streamHeartbeat = 25 * time.Second
+	// streamWriteTimeout bounds each write to a stream client
+	streamWriteTimeout = 10 * time.Second
+	// streamRecheck is how often a stream's credentials and role are checked
+	// again, so expired or revoked tokens and role changes take effect
+	// without waiting for the client to reconnect
+	streamRecheck = 10 * time.Second
+)
+
+// StreamHandler handles the real-time task change stream
+type StreamHandler struct {
+	hub    *stream.Hub
+	authz  *authz.Authorizer
+	tokens *auth.TokenStore
+}
+
+// NewStreamHandler creates a new stream handler
+func NewStreamHandler(hub *stream.Hub, authorizer *authz.Authorizer, tokens *auth.TokenStore) *StreamHandler {
+	return &StreamHandler{
+		hub:    hub,
+		authz:  authorizer,
+		tokens: tokens,
+	}
+}
+
+// streamWriter writes events to one connected client
+type streamWriter interface {
+	writeEvent(event models.TaskEvent) error
+	writePing() error
+}
+
+// Stream pushes task changes to the caller as they happen
+// @Summary Stream task changes
+// @Description Push task create, update and delete events from the projects the caller can read, as Server-Sent Events or, when the request is a WebSocket upgrade, as WebSocket JSON messages. Event IDs are task history event IDs: send the last one received as Last-Event-ID (or last_event_id) to resume, and events from up to a day back are replayed first. Events may commit out of ID order, so the replay also repeats events recorded shortly before the one resumed after; skip IDs already received. Clients that cannot set headers may pass the token as access_token. The caller's role is checked again every few seconds, and the stream ends once the token expires or is revoked. The stream may end at any time; clients should reconnect and resume.
+// @Tags stream
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param project_id query []int false "Only events from these projects"
+// @Param last_event_id query int false "Resume after this event ID"
+// @Param Last-Event-ID header int false "Resume after this event ID"
+// @Success 200 {object} models.TaskStreamMessage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /stream [get]
+func (h *StreamHandler) Stream(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var query models.TaskStreamQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if header := c.GetHeader("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+		query.LastEventID = &id
+	}
+
+	for _, projectID := range query.ProjectIDs {
+		if err := h.authz.RequireProject(subject, projectID, authz.AccessRead); err != nil {
+			respondAuthzError(c, err, "Project")
+			return
+		}
+	}
+
+	// Subscribe before catching up so nothing recorded in between is missed
+	sub := h.hub.Subscribe(subject, query.ProjectIDs)
+	defer h.hub.Unsubscribe(sub)
+
+	replay := []models.TaskEvent{}
+	if query.LastEventID != nil {
+		var err error
+		if replay, err = h.hub.Replay(sub, *query.LastEventID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay task events"})
+			return
+		}
+	}
+
+	recheck := h.recheck(c, sub, subject)
+
+	if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		server := websocket.Server{Handler: func(ws *websocket.Conn) {
+			h.serveWebSocket(ws, sub, replay, recheck)
+		}}
+		server.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	h.serveSSE(c, sub, replay, recheck)
+}
+
+// recheck returns a function that checks the stream's credentials again,
+// reporting false once the access token has expired or been revoked or the
+// API key is gone. Otherwise the subscription follows the user's current role.
+func (h *StreamHandler) recheck(c *gin.Context, sub *stream.Subscription, subject authz.Subject) func() bool {
+	claims, _ := c.Get("claims")
+	keyID, _ := c.Get("api_key_id")
+
+	return func() bool {
+		var role string
+		var err error
+		switch {
+		case claims != nil:
+			token := claims.(*auth.Claims)
+			if token.ExpiresAt != nil && !time.Now().Before(token.ExpiresAt.Time) {
+				return false
+			}
+			role, err = h.tokens.CurrentRole(token)
+		case keyID != nil:
+			role, err = h.tokens.APIKeyRole(keyID.(int))
+		default:
+			return false
+		}
+		if err != nil {
+			return false
+		}
+
+		if role != subject.Role {
+			permissions, err := h.authz.RolePermissions(role)
+			if err != nil {
+				return false
+			}
+			subject.Role = role
+			subject.Permissions = permissions
+			h.hub.Resubscribe(sub, subject)
+		}
+		return true
+	}
+}
+
+// pump writes the replayed events and then live ones until the subscription
+// ends, the client goes away, a write fails or recheck fails. Live events
+// that were already replayed are skipped.
+func pump(w streamWriter, sub *stream.Subscription, replay []models.TaskEvent, gone <-chan struct{}, recheck func() bool) {
+	replayed := make(map[int64]bool, len(replay))
+	for _, event := range replay {
+		if err := w.writeEvent(event); err != nil {
+			return
+		}
+		replayed[event.ID] = true
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	checks := time.NewTicker(streamRecheck)
+	defer checks.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if replayed[event.ID] {
+				continue
+			}
+			if err := w.writeEvent(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := w.writePing(); err != nil {
+				return
+			}
+		case <-checks.C:
+			if !recheck() {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// sseWriter writes Server-Sent Events to a hijacked connection
+type sseWriter struct {
+	conn net.Conn
+	buf  *bufio.ReadWriter
+}
+
+func (w *sseWriter) write(format string, args ...interface{}) error {
+	w.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if _, err := fmt.Fprintf(w.buf, format, args...); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+func (w *sseWriter) writeEvent(event models.TaskEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return w.write("id: %d\nevent: task.%s\ndata: %s\n\n", event.ID, event.EventType, data)
+}
+
+func (w *sseWriter) writePing() error {
+	return w.write(": ping\n\n")
+}
+
+// hijackResponse takes the connection over from the HTTP server, whose write
+// timeout would cut off long-running responses, and writes the status line
+// and the headers set so far. Callers set a deadline before each write. If it
+// fails, an error response has been written.
+func hijackResponse(c *gin.Context, status int) (net.Conn, *bufio.ReadWriter, bool) {
+	conn, buf, err := c.Writer.Hijack()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming is not supported on this connection"})
+		return nil, nil, false
+	}
+	conn.SetDeadline(time.Now().Add(streamWriteTimeout))
+
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	c.Writer.Header().Write(buf)
+	buf.WriteString("\r\n")
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, false
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, buf, true
+}
+
+// serveSSE streams events as Server-Sent Events over a hijacked connection
+func (h *StreamHandler) serveSSE(c *gin.Context, sub *stream.Subscription, replay []models.TaskEvent, recheck func() bool) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "close")
+	header.Set("X-Accel-Buffering", "no")
+
+	conn, buf, ok := hijackResponse(c, http.StatusOK)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	w := &sseWriter{conn: conn, buf: buf}
+	if err := w.write("retry: 3000\n\n"); err != nil {
+		return
+	}
+
+	// Clients send nothing after the request, so a read only returns once
+	// they disconnect
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, buf)
+		close(gone)
+	}()
+
+	pump(w, sub, replay, gone, recheck)
+}
+
+// wsWriter writes JSON messages to a WebSocket
+type wsWriter struct {
+	ws *websocket.Conn
+}
+
+func (w *wsWriter) send(message models.TaskStreamMessage) error {
+	w.ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return websocket.JSON.Send(w.ws, message)
+}
+
+func (w *wsWriter) writeEvent(event models.TaskEvent) error {
+	return w.send(models.TaskStreamMessage{ID: event.ID, Event: "task." + event.EventType, Data: &event})
+}
+
+func (w *wsWriter) writePing() error {
+	return w.send(models.TaskStreamMessage{Event: "ping"})
+}
+
+// serveWebSocket streams events as WebSocket JSON messages. Messages from
+// the client are ignored.
+func (h *StreamHandler) serveWebSocket(ws *websocket.Conn, sub *stream.Subscription, replay []models.TaskEvent, recheck func() bool) {
+	defer ws.Close()
+	ws.SetDeadline(time.Time{})
+
+	gone := make(chan struct{})
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		close(gone)
+	}()
+
+	pump(&wsWriter{ws: ws}, sub, replay, gone, recheck)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// BulkTasks applies a batch of task operations in a single transaction
+// @Summary Bulk task operations
+// @Description Create, update and delete tasks in one transaction. In atomic mode (the default) nothing is applied unless every operation succeeds; in best_effort mode each failed operation is rolled back on its own. Every operation gets a result, in request order.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.BulkTaskRequest true "Task operations"
+// @Success 200 {object} models.BulkTaskResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 422 {object} models.BulkTaskResponse
+// @Router /tasks/bulk [post]
+func (h *TaskHandler) BulkTasks(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var req models.BulkTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = models.BulkModeAtomic
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start bulk operation"})
+		return
+	}
+	defer tx.Rollback()
+
+	response := models.BulkTaskResponse{
+		Mode:    req.Mode,
+		Results: make([]models.BulkTaskResult, len(req.Operations)),
+	}
+
+	// Blobs of deleted tasks' attachments, collected once the batch commits
+	var blobs []string
+
+	// Each operation runs under a savepoint, so a failed statement only undoes
+	// that operation and the rest of the batch can still be checked
+	for i, op := range req.Operations {
+		if _, err := tx.Exec("SAVEPOINT bulk_task_op"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply bulk operation"})
+			return
+		}
+
+		result := h.applyBulkOperation(tx, subject, op, &blobs)
+		result.Index = i
+		response.Results[i] = result
+
+		release := "RELEASE SAVEPOINT bulk_task_op"
+		if result.Error != "" {
+			response.Failed++
+			release = "ROLLBACK TO SAVEPOINT bulk_task_op"
+		} else {
+			response.Succeeded++
+		}
+		if _, err := tx.Exec(release); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply bulk operation"})
+			return
+		}
+	}
+
+	if req.Mode == models.BulkModeAtomic && response.Failed > 0 {
+		for i := range response.Results {
+			if response.Results[i].Error == "" {
+				response.Results[i].Status = http.StatusFailedDependency
+				response.Results[i].Task = nil
+				response.Results[i].Error = "Not applied because another operation failed"
+			}
+		}
+		response.Succeeded = 0
+		response.Failed = len(response.Results)
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit bulk operation"})
+		return
+	}
+	response.Committed = true
+
+	collectBlobs(h.db, h.blobs, blobs)
+
+	// Update metrics once for the whole batch
+	if response.Succeeded > 0 {
+		h.updateTaskMetrics()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// applyBulkOperation runs one bulk operation inside tx and reports its outcome.
+// Failures are returned in the result rather than as an error. Deletes append
+// the attachment blobs they release to blobs.
+func (h *TaskHandler) applyBulkOperation(tx *sql.Tx, subject authz.Subject, op models.BulkTaskOperation, blobs *[]string) models.BulkTaskResult {
+	result := models.BulkTaskResult{Op: op.Op}
+	if op.ID != 0 {
+		id := op.ID
+		result.ID = &id
+	}
+
+	fail := func(status int, message string) models.BulkTaskResult {
+		result.Status = status
+		result.Error = message
+		return result
+	}
+
+	switch op.Op {
+	case models.BulkOpCreate:
+		var req models.CreateTaskRequest
+		if err := decodeBulkData(op.Data, &req); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if err := h.authz.RequireProjectIn(tx, subject, req.ProjectID, authz.AccessWrite); err != nil {
+			return failBulkError(result, err, "Project")
+		}
+		task, err := h.createTask(tx, req)
+		if err != nil {
+			return failBulkError(result, err, "Project")
+		}
+		result.ID = &task.ID
+		result.Status = http.StatusCreated
+		result.Task = &task
+
+	case models.BulkOpUpdate:
+		if op.ID <= 0 {
+			return fail(http.StatusBadRequest, "Invalid task ID")
+		}
+		var req models.UpdateTaskRequest
+		if err := decodeBulkData(op.Data, &req); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		if _, err := h.authz.RequireTaskIn(tx, subject, op.ID, authz.AccessWrite); err != nil {
+			return failBulkError(result, err, "Task")
+		}
+		task, err := h.updateTask(tx, op.ID, req)
+		if err != nil {
+			return failBulkError(result, err, "Task")
+		}
+		result.Status = http.StatusOK
+		result.Task = &task
+
+	case models.BulkOpDelete:
+		if op.ID <= 0 {
+			return fail(http.StatusBadRequest, "Invalid task ID")
+		}
+		if _, err := h.authz.RequireTaskIn(tx, subject, op.ID, authz.AccessWrite); err != nil {
+			return failBulkError(result, err, "Task")
+		}
+		released, err := h.deleteTask(tx, op.ID, models.DeleteChildrenReparent)
+		if err != nil {
+			return failBulkError(result, err, "Task")
+		}
+		*blobs = append(*blobs, released...)
+		result.Status = http.StatusNoContent
+	}
+
+	return result
+}
+
+// decodeBulkData decodes and validates the payload of a bulk operation
+func decodeBulkData(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 {
+		return errBulkDataRequired
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(v)
+}
+
+// failBulkError records err on result the way the single-task endpoints would respond to it
+func failBulkError(result models.BulkTaskResult, err error, resource string) models.BulkTaskResult {
+	if statusErr, ok := err.(*statusError); ok {
+		result.Status = http.StatusUnprocessableEntity
+		result.Error = statusErr.message
+		result.AllowedStatuses = statusErr.allowed
+		return result
+	}
+
+	if blockedErr, ok := err.(*blockedError); ok {
+		result.Status = http.StatusConflict
+		result.Error = "Task is blocked by open tasks"
+		result.BlockedBy = blockedErr.blockers
+		return result
+	}
+
+	switch {
+	case err == authz.ErrNotFound || err == sql.ErrNoRows:
+		result.Status = http.StatusNotFound
+		result.Error = resource + " not found"
+	case err == authz.ErrForbidden:
+		result.Status = http.StatusForbidden
+		result.Error = "Insufficient privileges"
+	case err == errNoFieldsToUpdate:
+		result.Status = http.StatusBadRequest
+		result.Error = "No fields to update"
+	case err == errActualHoursDerived:
+		result.Status = http.StatusBadRequest
+		result.Error = "actual_hours is the sum of the task's work logs and cannot be set"
+	case err == errInvalidParent:
+		result.Status = http.StatusBadRequest
+		result.Error = "Parent task not found in this project"
+	case err == errParentCycle:
+		result.Status = http.StatusBadRequest
+		result.Error = "A task cannot be moved under itself or one of its subtasks"
+	case isForeignKeyViolation(err):
+		result.Status = http.StatusBadRequest
+		result.Error = "Referenced assignee or project not found"
+	default:
+		result.Status = http.StatusInternalServerError
+		result.Error = "Failed to apply operation"
+	}
+	return result
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// openTaskCondition matches tasks that still block their dependents: those
+// neither completed nor cancelled. table is the SQL alias of the tasks table.
+func openTaskCondition(table string) string {
+	return table + ".completed_at IS NULL AND " + table + ".status <> '" + string(models.TaskStatusCancelled) + "'"
+}
+
+// blockedTaskCondition matches tasks in the outer query that have at least one open blocker
+var blockedTaskCondition = `EXISTS (
+		SELECT 1 FROM task_dependencies d
+		JOIN tasks b ON b.id = d.blocked_by_id
+		WHERE d.task_id = tasks.id AND ` + openTaskCondition("b") + `
+	)`
+
+// blockedError reports a status change refused because the task has open blockers
+type blockedError struct {
+	blockers []int
+}
+
+func (e *blockedError) Error() string {
+	return "task is blocked by open tasks"
+}
+
+// respondBlockedError writes the 409 for a task that cannot start or finish
+// yet, listing the open blockers
+func respondBlockedError(c *gin.Context, err *blockedError) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":      "Task is blocked by open tasks; set override_blockers to change its status anyway",
+		"blocked_by": err.blockers,
+	})
+}
+
+// requiresUnblocked reports whether moving a task to status needs its blockers to be resolved
+func requiresUnblocked(workflow models.Workflow, status string) bool {
+	return status == string(models.TaskStatusInProgress) || workflow.IsCompleted(status)
+}
+
+// openBlockers returns the IDs of the open tasks blocking a task
+func openBlockers(tx *sql.Tx, taskID int) ([]int, error) {
+	rows, err := tx.Query(`
+		SELECT b.id FROM task_dependencies d
+		JOIN tasks b ON b.id = d.blocked_by_id
+		WHERE d.task_id = $1 AND `+openTaskCondition("b")+`
+		ORDER BY b.id
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blockers []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blockers = append(blockers, id)
+	}
+	return blockers, rows.Err()
+}
+
+// dependencyCycle returns the cycle that making taskID blocked by blockerID
+// would close, starting and ending at taskID, or nil if there is none
+func dependencyCycle(tx *sql.Tx, taskID, blockerID int) ([]int, error) {
+	var path pq.Int64Array
+	err := tx.QueryRow(`
+		WITH RECURSIVE chain (task_id, path) AS (
+			SELECT $1::INTEGER, ARRAY[$1::INTEGER]
+			UNION ALL
+			SELECT d.blocked_by_id, chain.path || d.blocked_by_id
+			FROM task_dependencies d
+			JOIN chain ON d.task_id = chain.task_id
+			WHERE d.blocked_by_id <> ALL(chain.path)
+		)
+		SELECT path FROM chain WHERE task_id = $2 LIMIT 1
+	`, blockerID, taskID).Scan(&path)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	cycle := []int{taskID}
+	for _, id := range path {
+		cycle = append(cycle, int(id))
+	}
+	return cycle, nil
+}
+
+// GetTaskDependencies lists the dependencies of a task
+// @Summary Get task dependencies
+// @Description Get the tasks blocking a task and the tasks it blocks. A blocker stays open until it is done or cancelled. Only tasks in projects visible to the caller are listed.
+// @Tags tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.TaskDependencies
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/dependencies [get]
+func (h *TaskHandler) GetTaskDependencies(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, id, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	deps := models.TaskDependencies{TaskID: id}
+
+	deps.BlockedBy, err = h.dependencyTasks(subject, id, "d.task_id", "d.blocked_by_id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get task dependencies"})
+		return
+	}
+
+	deps.Blocks, err = h.dependencyTasks(subject, id, "d.blocked_by_id", "d.task_id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get task dependencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deps)
+}
+
+// dependencyTasks returns the visible tasks joined to taskID through the
+// task_dependencies column pair from -> to
+func (h *TaskHandler) dependencyTasks(subject authz.Subject, taskID int, from, to string) ([]models.DependencyTask, error) {
+	query := `
+		SELECT t.id, t.title, t.status, t.project_id, (` + openTaskCondition("t") + `), d.created_at
+		FROM task_dependencies d
+		JOIN tasks t ON t.id = ` + to + `
+		WHERE ` + from + ` = $1`
+	args := []interface{}{taskID}
+
+	if condition, conditionArgs := h.authz.VisibleProjectsCondition(subject, "t.project_id", 2); condition != "" {
+		query += " AND " + condition
+		args = append(args, conditionArgs...)
+	}
+	query += " ORDER BY t.id"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []models.DependencyTask{}
+	for rows.Next() {
+		var task models.DependencyTask
+		if err := rows.Scan(&task.ID, &task.Title, &task.Status, &task.ProjectID, &task.Open, &task.CreatedAt); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// AddTaskDependency marks a task as blocked by another task
+// @Summary Add task dependency
+// @Description Mark a task as blocked by another task. Requires write access to the task and read access to the blocker. Dependencies that would form a cycle are rejected.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param request body models.AddTaskDependencyRequest true "Blocking task"
+// @Success 201 {object} models.TaskDependency
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
+// @Router /tasks/{id}/dependencies [post]
+func (h *TaskHandler) AddTaskDependency(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var req models.AddTaskDependencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.BlockedByID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A task cannot block itself"})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, id, authz.AccessWrite); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, req.BlockedByID, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Blocking task")
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add task dependency"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Serialize dependency inserts so two concurrent edges cannot close a
+	// cycle that neither transaction sees on its own
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('task_dependencies'))`); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add task dependency"})
+		return
+	}
+
+	cycle, err := dependencyCycle(tx, id, req.BlockedByID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add task dependency"})
+		return
+	}
+	if cycle != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Dependency would create a cycle", "cycle": cycle})
+		return
+	}
+
+	// The foreign keys key-share lock both tasks, so a concurrent status
+	// change of the blocked task waits for this insert and sees the new blocker
+	var dep models.TaskDependency
+	err = tx.QueryRow(`
+		INSERT INTO task_dependencies (task_id, blocked_by_id, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING task_id, blocked_by_id, created_by, created_at
+	`, id, req.BlockedByID, subject.UserID).Scan(&dep.TaskID, &dep.BlockedByID, &dep.CreatedBy, &dep.CreatedAt)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			c.JSON(http.StatusConflict, gin.H{"error": "Dependency already exists"})
+		case isForeignKeyViolation(err):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add task dependency"})
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add task dependency"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dep)
+}
+
+// RemoveTaskDependency removes a blocker from a task
+// @Summary Remove task dependency
+// @Description Remove a blocker from a task. Requires write access to the blocked task.
+// @Tags tasks
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param blocker_id path int true "Blocking task ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/dependencies/{blocker_id} [delete]
+func (h *TaskHandler) RemoveTaskDependency(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	blockerID, err := strconv.Atoi(c.Param("blocker_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blocking task ID"})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, id, authz.AccessWrite); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM task_dependencies WHERE task_id = $1 AND blocked_by_id = $2`, id, blockerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove task dependency"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task dependency not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
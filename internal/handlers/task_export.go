@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// taskExportBatch is how many rows are fetched from the export cursor at a
+// time, which bounds the memory an export uses
+const taskExportBatch = 1000
+
+type exportKind int
+
+const (
+	exportInt exportKind = iota
+	exportText
+	exportFloat
+	exportTime
+	exportTags
+)
+
+// taskExportColumns lists the columns an export can include
+var taskExportColumns = map[string]exportKind{
+	"id":              exportInt,
+	"title":           exportText,
+	"description":     exportText,
+	"status":          exportText,
+	"priority":        exportInt,
+	"assignee_id":     exportInt,
+	"project_id":      exportInt,
+	"parent_id":       exportInt,
+	"created_at":      exportTime,
+	"updated_at":      exportTime,
+	"completed_at":    exportTime,
+	"due_date":        exportTime,
+	"estimated_hours": exportFloat,
+	"actual_hours":    exportFloat,
+	"tags":            exportTags,
+}
+
+// defaultTaskExportColumns is the column order used when none are selected
+var defaultTaskExportColumns = []string{
+	"id", "title", "description", "status", "priority", "assignee_id", "project_id", "parent_id",
+	"created_at", "updated_at", "completed_at", "due_date", "estimated_hours", "actual_hours", "tags",
+}
+
+// ExportTasks streams every task matching the filters
+// @Summary Export tasks
+// @Description Stream every task matching the GET /tasks filters as CSV or NDJSON, in the requested sort order. The export reads one consistent snapshot and is not paginated. A response that ends before the final chunk was cut short. CSV cells starting with =, +, - or @ are prefixed with ' so spreadsheets do not run them as formulas; tags are joined with commas.
+// @Tags tasks
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Param format query string false "csv or ndjson" default(csv)
+// @Param columns query []string false "Columns to include, in order" collectionFormat(csv)
+// @Param timezone query string false "IANA time zone for timestamps" default(UTC)
+// @Param q query string false "Full-text search over title and description"
+// @Param status query []string false "Filter by status"
+// @Param assignee_id query int false "Filter by assignee ID"
+// @Param project_id query int false "Filter by project ID"
+// @Param priority query int false "Filter by priority"
+// @Param from_date query string false "Filter from date (YYYY-MM-DD)"
+// @Param to_date query string false "Filter to date (YYYY-MM-DD)"
+// @Param tags query []string false "Filter by tags"
+// @Param blocked query bool false "Only tasks with (true) or without (false) open blockers"
+// @Param sort_by query string false "Sort by field" default(created_at)
+// @Param sort_order query string false "Sort order (asc/desc)" default(desc)
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/export [get]
+func (h *TaskHandler) ExportTasks(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var query models.TaskExportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Format == "" {
+		query.Format = "csv"
+	}
+	if query.Format != "csv" && query.Format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format: " + query.Format})
+		return
+	}
+
+	columns, err := parseExportColumns(query.Columns)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Timezone == "" {
+		query.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(query.Timezone)
+	if err != nil || query.Timezone == "Local" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone: " + query.Timezone})
+		return
+	}
+
+	searchExpr, _ := taskSearchExpr(query.Q, 1)
+	query.SortBy, query.SortOrder = normalizeTaskSort(query.SortBy, query.SortOrder, searchExpr != "")
+
+	if query.ProjectID != nil {
+		if err := h.authz.RequireProject(subject, *query.ProjectID, authz.AccessRead); err != nil {
+			respondAuthzError(c, err, "Project")
+			return
+		}
+	}
+
+	whereClause, args := h.buildTaskWhereClause(subject, query.TaskQuery)
+	orderClause := h.buildTaskOrderClause(query.SortBy, query.SortOrder)
+	if query.SortBy == taskRelevanceSort {
+		// The search expression's arguments are always the first in args
+		orderClause = " ORDER BY ts_rank_cd(search_vector, " + searchExpr + ") " + query.SortOrder + ", id " + query.SortOrder
+	}
+
+	// The cursor keeps the result on the server, so it is read in batches
+	// from one snapshot however many rows match
+	tx, err := h.db.BeginTx(c.Request.Context(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export tasks"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DECLARE task_export NO SCROLL CURSOR FOR
+		SELECT `+strings.Join(columns, ", ")+`
+		FROM tasks`+whereClause+orderClause, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export tasks"})
+		return
+	}
+
+	header := c.Writer.Header()
+	filename := "tasks-" + time.Now().In(loc).Format("20060102-150405") + "." + query.Format
+	if query.Format == "csv" {
+		header.Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		header.Set("Content-Type", "application/x-ndjson")
+	}
+	header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	header.Set("Transfer-Encoding", "chunked")
+	header.Set("Connection", "close")
+
+	conn, buf, ok := hijackResponse(c, http.StatusOK)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	// Chunked encoding lets clients tell a complete export from one that
+	// failed part way, which only ends without the final chunk
+	chunked := httputil.NewChunkedWriter(&deadlineWriter{conn: conn, w: buf})
+	out := bufio.NewWriterSize(chunked, 32<<10)
+
+	var rows exportWriter
+	if query.Format == "csv" {
+		rows = &csvExportWriter{w: csv.NewWriter(out), loc: loc}
+	} else {
+		rows = &ndjsonExportWriter{w: out, loc: loc}
+	}
+
+	if err := exportTaskRows(tx, columns, rows); err != nil {
+		return
+	}
+	if err := out.Flush(); err != nil {
+		return
+	}
+	if err := chunked.Close(); err != nil {
+		return
+	}
+	buf.WriteString("\r\n")
+	buf.Flush()
+}
+
+// exportTaskRows writes a header and then every row of the task_export
+// cursor, a batch at a time
+func exportTaskRows(tx *sql.Tx, columns []string, w exportWriter) error {
+	if err := w.header(columns); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch taskExportColumns[column] {
+		case exportInt:
+			values[i] = &sql.NullInt64{}
+		case exportText:
+			values[i] = &sql.NullString{}
+		case exportFloat:
+			values[i] = &sql.NullFloat64{}
+		case exportTime:
+			values[i] = &sql.NullTime{}
+		case exportTags:
+			values[i] = &pq.StringArray{}
+		}
+	}
+
+	for {
+		rows, err := tx.Query(`FETCH ` + strconv.Itoa(taskExportBatch) + ` FROM task_export`)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			if err := rows.Scan(values...); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := w.row(columns, values); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if err := w.flush(); err != nil {
+			return err
+		}
+		if fetched < taskExportBatch {
+			return nil
+		}
+	}
+}
+
+// parseExportColumns validates the selected columns, which may be given
+// comma-separated, repeated or both
+func parseExportColumns(selected []string) ([]string, error) {
+	var columns []string
+	seen := map[string]bool{}
+	for _, value := range selected {
+		for _, column := range strings.Split(value, ",") {
+			column = strings.TrimSpace(column)
+			if column == "" {
+				continue
+			}
+			if _, ok := taskExportColumns[column]; !ok {
+				return nil, errors.New("Invalid column: " + column)
+			}
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return defaultTaskExportColumns, nil
+	}
+	return columns, nil
+}
+
+// exportValue converts a scanned column value to a JSON-friendly value, or
+// nil for NULL
+func exportValue(value interface{}, loc *time.Location) interface{} {
+	switch v := value.(type) {
+	case *sql.NullInt64:
+		if v.Valid {
+			return v.Int64
+		}
+	case *sql.NullString:
+		if v.Valid {
+			return v.String
+		}
+	case *sql.NullFloat64:
+		if v.Valid {
+			return v.Float64
+		}
+	case *sql.NullTime:
+		if v.Valid {
+			return v.Time.In(loc).Format(time.RFC3339)
+		}
+	case *pq.StringArray:
+		if *v != nil {
+			return []string(*v)
+		}
+		return []string{}
+	}
+	return nil
+}
+
+// exportWriter writes export rows in one format
+type exportWriter interface {
+	header(columns []string) error
+	row(columns []string, values []interface{}) error
+	flush() error
+}
+
+// csvExportWriter writes a header line and one CSV record per task
+type csvExportWriter struct {
+	w   *csv.Writer
+	loc *time.Location
+}
+
+func (e *csvExportWriter) header(columns []string) error {
+	return e.w.Write(columns)
+}
+
+func (e *csvExportWriter) row(columns []string, values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := exportValue(value, e.loc).(type) {
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			if taskExportColumns[columns[i]] == exportText {
+				v = escapeCSVFormula(v)
+			}
+			record[i] = v
+		case []string:
+			record[i] = escapeCSVFormula(strings.Join(v, ","))
+		}
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvExportWriter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// escapeCSVFormula keeps spreadsheets from evaluating user text as a formula
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ndjsonExportWriter writes one JSON object per line, with keys in column
+// order. It has no header line.
+type ndjsonExportWriter struct {
+	w   *bufio.Writer
+	loc *time.Location
+}
+
+func (e *ndjsonExportWriter) header(columns []string) error {
+	return nil
+}
+
+func (e *ndjsonExportWriter) row(columns []string, values []interface{}) error {
+	e.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(columns[i])
+		data, err := json.Marshal(exportValue(value, e.loc))
+		if err != nil {
+			return err
+		}
+		e.w.Write(key)
+		e.w.WriteByte(':')
+		e.w.Write(data)
+	}
+	e.w.WriteByte('}')
+	_, err := e.w.WriteString("\n")
+	return err
+}
+
+func (e *ndjsonExportWriter) flush() error {
+	return e.w.Flush()
+}
+
+// deadlineWriter sets a write deadline on conn before each write to w
+type deadlineWriter struct {
+	conn net.Conn
+	w    *bufio.ReadWriter
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	n, err := d.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, d.w.Flush()
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// beginActorTx starts a transaction and records the acting user in the
+// app.actor_id setting, which the task_events trigger attributes changes to.
+func beginActorTx(db *sql.DB, actorID int) (*sql.Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`SELECT set_config('app.actor_id', $1, TRUE)`, strconv.Itoa(actorID)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// GetTaskHistory retrieves the change history of a task
+// @Summary Get task history
+// @Description Get the recorded create, update and delete events of a task, oldest first. Deleted tasks keep their history.
+// @Tags tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param from query string false "Only events at or after this time (RFC 3339)"
+// @Param to query string false "Only events at or before this time (RFC 3339)"
+// @Param limit query int false "Limit results" default(100)
+// @Success 200 {array} models.TaskEvent
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/history [get]
+func (h *TaskHandler) GetTaskHistory(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var query models.TaskHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit <= 0 || query.Limit > 1000 {
+		query.Limit = 100
+	}
+
+	if err := h.authorizeTaskHistory(subject, id); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	queryStr := `
+		SELECT id, occurred_at, task_id, project_id, actor_id, event_type, changes
+		FROM task_events
+		WHERE task_id = $1`
+	args := []interface{}{id}
+
+	if query.From != nil {
+		args = append(args, *query.From)
+		queryStr += ` AND occurred_at >= $` + strconv.Itoa(len(args))
+	}
+
+	if query.To != nil {
+		args = append(args, *query.To)
+		queryStr += ` AND occurred_at <= $` + strconv.Itoa(len(args))
+	}
+
+	args = append(args, query.Limit)
+	queryStr += ` ORDER BY occurred_at, id LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := h.db.Query(queryStr, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query task history"})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.TaskEvent{}
+	for rows.Next() {
+		var event models.TaskEvent
+		var changes []byte
+		err := rows.Scan(
+			&event.ID, &event.OccurredAt, &event.TaskID, &event.ProjectID,
+			&event.ActorID, &event.EventType, &changes,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan task event"})
+			return
+		}
+		if err := json.Unmarshal(changes, &event.Changes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode task event"})
+			return
+		}
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// authorizeTaskHistory checks read access to a task's history. A deleted task
+// is authorized against the project recorded in its most recent event.
+func (h *TaskHandler) authorizeTaskHistory(subject authz.Subject, taskID int) error {
+	_, err := h.authz.RequireTask(subject, taskID, authz.AccessRead)
+	if err != authz.ErrNotFound {
+		return err
+	}
+
+	var projectID int
+	err = h.db.QueryRow(`
+		SELECT project_id FROM task_events
+		WHERE task_id = $1
+		ORDER BY occurred_at DESC
+		LIMIT 1
+	`, taskID).Scan(&projectID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return authz.ErrNotFound
+		}
+		return err
+	}
+
+	return h.authz.RequireProject(subject, projectID, authz.AccessRead)
+}
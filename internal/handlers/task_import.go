@@ -0,0 +1,751 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	// taskImportMaxBytes bounds the size of an import file
+	taskImportMaxBytes = 64 << 20
+	// taskImportBatch is how many rows are inserted per transaction
+	taskImportBatch = 500
+	// maxTaskTitleLength is the length of the tasks.title column
+	maxTaskTitleLength = 255
+)
+
+// taskImportFields lists the fields an import can set. assignee is a username
+// or email address, resolved to assignee_id.
+var taskImportFields = map[string]bool{
+	"title":           true,
+	"description":     true,
+	"status":          true,
+	"priority":        true,
+	"assignee_id":     true,
+	"assignee":        true,
+	"project_id":      true,
+	"parent_id":       true,
+	"due_date":        true,
+	"estimated_hours": true,
+	"tags":            true,
+}
+
+// taskImportDateLayouts are the accepted due_date formats. Layouts without a
+// zone are read in the import's time zone.
+var taskImportDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// importRow is one row of an import file and the task it describes
+type importRow struct {
+	line     int
+	req      models.CreateTaskRequest
+	assignee string
+	set      map[string]bool
+	errors   []models.TaskImportError
+}
+
+func (r *importRow) fail(field, message string) {
+	r.errors = append(r.errors, models.TaskImportError{Line: r.line, Field: field, Error: message})
+}
+
+// ImportTasks creates tasks from a CSV or NDJSON file
+// @Summary Import tasks
+// @Description Create tasks from a CSV file with a header row or from NDJSON objects, one per line. Columns (or keys) named after task fields are imported: title, description, status, priority, assignee_id, assignee (username or email), project_id, parent_id, due_date (RFC 3339 or YYYY-MM-DD), estimated_hours and tags (comma-separated, or a JSON array). Other columns are ignored unless renamed with map=source:field. Every row is validated first. Unless skip_invalid is set, nothing is imported when any row is invalid; valid rows are then inserted in batches, and the report lists every row that was not imported by its line in the file.
+// @Tags tasks
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Security BearerAuth
+// @Param file body string true "CSV or NDJSON file"
+// @Param format query string false "csv or ndjson; defaults to the Content-Type"
+// @Param dry_run query bool false "Only validate the file"
+// @Param skip_invalid query bool false "Import the valid rows even if some are invalid"
+// @Param project_id query int false "Project for rows without a project_id"
+// @Param map query []string false "Column renames as source:field" collectionFormat(multi)
+// @Param timezone query string false "IANA time zone for due dates without one" default(UTC)
+// @Success 200 {object} models.TaskImportReport
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} models.TaskImportReport
+// @Router /tasks/import [post]
+func (h *TaskHandler) ImportTasks(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var query models.TaskImportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Format == "" {
+		query.Format = importFormat(c.ContentType())
+	}
+	if query.Format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set format to csv or ndjson, or send a text/csv or application/x-ndjson body"})
+		return
+	}
+
+	if query.Timezone == "" {
+		query.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(query.Timezone)
+	if err != nil || query.Timezone == "Local" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone: " + query.Timezone})
+		return
+	}
+
+	mapping, err := parseImportMapping(query.Mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, taskImportMaxBytes)
+	var rows []*importRow
+	var ignored []string
+	if query.Format == models.ImportFormatCSV {
+		rows, ignored, err = readCSVImport(body, mapping, loc)
+	} else {
+		rows, ignored, err = readNDJSONImport(body, mapping, loc)
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Import files are limited to %d MB", taskImportMaxBytes>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file has no rows"})
+		return
+	}
+
+	if query.ProjectID != nil {
+		for _, row := range rows {
+			if !row.set["project_id"] {
+				row.req.ProjectID = *query.ProjectID
+			}
+		}
+	}
+
+	if err := h.validateImport(subject, rows); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate import"})
+		return
+	}
+
+	report := models.TaskImportReport{
+		Format:         query.Format,
+		DryRun:         query.DryRun,
+		Rows:           len(rows),
+		IgnoredColumns: ignored,
+		Errors:         []models.TaskImportError{},
+	}
+	var valid []*importRow
+	for _, row := range rows {
+		if len(row.errors) > 0 {
+			report.Invalid++
+			report.Errors = append(report.Errors, row.errors...)
+		} else {
+			valid = append(valid, row)
+		}
+	}
+	report.Valid = len(valid)
+
+	if query.DryRun {
+		respondImport(c, http.StatusOK, report)
+		return
+	}
+	if report.Invalid > 0 && !query.SkipInvalid {
+		respondImport(c, http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	h.insertImport(subject.UserID, valid, &report)
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+
+	// Update metrics once for the whole import
+	if report.Inserted > 0 {
+		h.updateTaskMetrics()
+	}
+
+	respondImport(c, http.StatusOK, report)
+}
+
+// importFormat returns the import format for a request content type, or ""
+func importFormat(contentType string) string {
+	switch contentType {
+	case "text/csv", "application/csv":
+		return models.ImportFormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return models.ImportFormatNDJSON
+	}
+	return ""
+}
+
+// normalizeImportColumn makes a column name comparable with field names, so
+// "Due Date" and "due-date" both name due_date
+func normalizeImportColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+// parseImportMapping reads source:field column renames
+func parseImportMapping(entries []string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return nil, errors.New("Invalid map entry, expected source:field: " + entry)
+		}
+		field := normalizeImportColumn(entry[i+1:])
+		if !taskImportFields[field] {
+			return nil, errors.New("Invalid map field: " + entry[i+1:])
+		}
+		mapping[normalizeImportColumn(entry[:i])] = field
+	}
+	return mapping, nil
+}
+
+// importField returns the task field a column imports into, or "" if the
+// column is not imported
+func importField(column string, mapping map[string]string) string {
+	column = normalizeImportColumn(column)
+	if field, ok := mapping[column]; ok {
+		return field
+	}
+	if taskImportFields[column] {
+		return column
+	}
+	return ""
+}
+
+// readCSVImport parses a CSV file with a header row. Columns that are not
+// imported are returned as ignored.
+func readCSVImport(body io.Reader, mapping map[string]string, loc *time.Location) ([]*importRow, []string, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Spreadsheets often save CSV with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	fields := make([]string, len(header))
+	var ignored []string
+	mappedFrom := map[string]string{}
+	for i, column := range header {
+		field := importField(column, mapping)
+		if field == "" {
+			ignored = append(ignored, column)
+			continue
+		}
+		if other, ok := mappedFrom[field]; ok {
+			return nil, nil, fmt.Errorf("Columns %q and %q both import into %s", other, column, field)
+		}
+		mappedFrom[field] = column
+		fields[i] = field
+	}
+
+	var rows []*importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, ignored, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := &importRow{line: line, set: map[string]bool{}}
+		if len(record) != len(header) {
+			row.fail("", fmt.Sprintf("Expected %d columns, found %d", len(header), len(record)))
+		} else {
+			for i, value := range record {
+				if fields[i] != "" {
+					row.setField(fields[i], value, loc)
+				}
+			}
+			row.check()
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readNDJSONImport parses one JSON object per line. Blank lines are skipped
+// and keys that are not imported are returned as ignored.
+func readNDJSONImport(body io.Reader, mapping map[string]string, loc *time.Location) ([]*importRow, []string, error) {
+	reader := bufio.NewReader(body)
+	var rows []*importRow
+	var ignored []string
+	ignoredSeen := map[string]bool{}
+
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+
+		if len(bytes.TrimSpace(data)) > 0 {
+			row := &importRow{line: line, set: map[string]bool{}}
+			rows = append(rows, row)
+
+			var object map[string]interface{}
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.UseNumber()
+			if decodeErr := decoder.Decode(&object); decodeErr != nil || object == nil {
+				row.fail("", "Invalid JSON object")
+			} else {
+				keys := make([]string, 0, len(object))
+				for key := range object {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+
+				for _, key := range keys {
+					field := importField(key, mapping)
+					if field == "" {
+						if !ignoredSeen[key] {
+							ignoredSeen[key] = true
+							ignored = append(ignored, key)
+						}
+						continue
+					}
+					if row.set[field] {
+						row.fail(field, "More than one key imports into "+field)
+						continue
+					}
+					row.setField(field, object[key], loc)
+				}
+				row.check()
+			}
+		}
+
+		if err == io.EOF {
+			return rows, ignored, nil
+		}
+	}
+}
+
+// setField parses a CSV cell or JSON value into field. Empty values leave the
+// field unset.
+func (r *importRow) setField(field string, value interface{}, loc *time.Location) {
+	if field == "tags" {
+		tags, ok := importTags(value)
+		if !ok {
+			r.fail(field, "Tags must be a comma-separated string or an array of strings")
+			return
+		}
+		r.req.Tags = tags
+		r.set[field] = len(tags) > 0
+		return
+	}
+
+	text, ok := importText(value)
+	if !ok {
+		r.fail(field, "Invalid "+field+": must be a string or a number")
+		return
+	}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return
+	}
+	r.set[field] = true
+
+	switch field {
+	case "title":
+		r.req.Title = trimmed
+	case "description":
+		r.req.Description = text
+	case "status":
+		r.req.Status = trimmed
+	case "assignee":
+		r.assignee = trimmed
+	case "priority":
+		priority, err := strconv.Atoi(trimmed)
+		if err != nil {
+			r.fail(field, "Invalid priority: "+trimmed)
+			return
+		}
+		r.req.Priority = priority
+	case "assignee_id", "project_id", "parent_id":
+		id, err := strconv.Atoi(trimmed)
+		if err != nil || id <= 0 {
+			r.fail(field, "Invalid "+field+": "+trimmed)
+			return
+		}
+		switch field {
+		case "assignee_id":
+			r.req.AssigneeID = &id
+		case "project_id":
+			r.req.ProjectID = id
+		case "parent_id":
+			r.req.ParentID = &id
+		}
+	case "due_date":
+		for _, layout := range taskImportDateLayouts {
+			if due, err := time.ParseInLocation(layout, trimmed, loc); err == nil {
+				r.req.DueDate = &due
+				return
+			}
+		}
+		r.fail(field, "Invalid due_date, expected RFC 3339 or YYYY-MM-DD: "+trimmed)
+	case "estimated_hours":
+		hours, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil || hours < 0 || math.IsInf(hours, 0) || math.IsNaN(hours) {
+			r.fail(field, "Invalid estimated_hours: "+trimmed)
+			return
+		}
+		r.req.EstimatedHours = &hours
+	}
+}
+
+// check validates what a row needs without looking at the database
+func (r *importRow) check() {
+	if r.req.Title == "" && !r.failed("title") {
+		r.fail("title", "Title is required")
+	} else if utf8.RuneCountInString(r.req.Title) > maxTaskTitleLength {
+		r.fail("title", fmt.Sprintf("Title is longer than %d characters", maxTaskTitleLength))
+	}
+	if r.set["assignee"] && r.set["assignee_id"] {
+		r.fail("assignee", "Set assignee or assignee_id, not both")
+	}
+}
+
+// failed reports whether the row already has an error for field
+func (r *importRow) failed(field string) bool {
+	for _, e := range r.errors {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// importText returns a scalar cell as text. JSON null is empty.
+func importText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// importTags splits comma-separated tags or reads a JSON array of strings
+func importTags(value interface{}) ([]string, bool) {
+	var values []string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		values = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			tag, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, tag)
+		}
+	default:
+		return nil, false
+	}
+
+	var tags []string
+	for _, tag := range values {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, true
+}
+
+// validateImport checks each row's project, status, assignee and parent
+// against the database, recording problems on the rows. It only returns
+// errors from the database itself.
+func (h *TaskHandler) validateImport(subject authz.Subject, rows []*importRow) error {
+	type importProject struct {
+		workflow models.Workflow
+		problem  string
+	}
+	projects := map[int]*importProject{}
+
+	assigneeIDs := map[int]bool{}
+	assignees := map[string]bool{}
+	parentIDs := map[int]bool{}
+
+	for _, row := range rows {
+		if row.req.ProjectID == 0 {
+			if !row.failed("project_id") {
+				row.fail("project_id", "Project is required")
+			}
+			continue
+		}
+
+		project, ok := projects[row.req.ProjectID]
+		if !ok {
+			project = &importProject{}
+			err := h.authz.RequireProject(subject, row.req.ProjectID, authz.AccessWrite)
+			if err == nil {
+				project.workflow, err = loadWorkflow(h.db, row.req.ProjectID, false)
+			}
+			switch {
+			case err == authz.ErrNotFound || err == sql.ErrNoRows:
+				project.problem = "Project not found"
+			case err == authz.ErrForbidden:
+				project.problem = "Insufficient privileges"
+			case err != nil:
+				return err
+			}
+			projects[row.req.ProjectID] = project
+		}
+
+		if project.problem != "" {
+			row.fail("project_id", project.problem)
+			continue
+		}
+		if row.req.Status != "" && !project.workflow.HasStatus(row.req.Status) {
+			row.fail("status", "Invalid status: "+row.req.Status)
+		}
+
+		if row.req.AssigneeID != nil {
+			assigneeIDs[*row.req.AssigneeID] = true
+		}
+		if row.assignee != "" {
+			assignees[row.assignee] = true
+		}
+		if row.req.ParentID != nil {
+			parentIDs[*row.req.ParentID] = true
+		}
+	}
+
+	users, err := h.importUsers(assigneeIDs, assignees)
+	if err != nil {
+		return err
+	}
+	parents, err := h.importParents(parentIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if row.req.AssigneeID != nil && !users.ids[*row.req.AssigneeID] {
+			row.fail("assignee_id", "Assignee not found")
+		}
+		if row.assignee != "" {
+			id, ok := users.names[row.assignee]
+			if !ok {
+				id, ok = users.emails[strings.ToLower(row.assignee)]
+			}
+			if !ok {
+				row.fail("assignee", "Assignee not found: "+row.assignee)
+			} else {
+				row.req.AssigneeID = &id
+			}
+		}
+		if row.req.ParentID != nil && !row.failed("project_id") && parents[*row.req.ParentID] != row.req.ProjectID {
+			row.fail("parent_id", "Parent task not found in this project")
+		}
+	}
+	return nil
+}
+
+// importUserSet holds the users an import refers to
+type importUserSet struct {
+	ids    map[int]bool
+	names  map[string]int
+	emails map[string]int
+}
+
+// importUsers looks up the users referenced by ID, username or email
+func (h *TaskHandler) importUsers(ids map[int]bool, names map[string]bool) (importUserSet, error) {
+	users := importUserSet{ids: map[int]bool{}, names: map[string]int{}, emails: map[string]int{}}
+	if len(ids) == 0 && len(names) == 0 {
+		return users, nil
+	}
+
+	idList := make([]int64, 0, len(ids))
+	for id := range ids {
+		idList = append(idList, int64(id))
+	}
+	nameList := make([]string, 0, len(names))
+	emailList := make([]string, 0, len(names))
+	for name := range names {
+		nameList = append(nameList, name)
+		emailList = append(emailList, strings.ToLower(name))
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, username, email
+		FROM users
+		WHERE id = ANY($1) OR username = ANY($2) OR lower(email) = ANY($3)
+	`, pq.Array(idList), pq.Array(nameList), pq.Array(emailList))
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var username, email string
+		if err := rows.Scan(&id, &username, &email); err != nil {
+			return users, err
+		}
+		users.ids[id] = true
+		users.names[username] = id
+		users.emails[strings.ToLower(email)] = id
+	}
+	return users, rows.Err()
+}
+
+// importParents returns the project of each existing parent task
+func (h *TaskHandler) importParents(ids map[int]bool) (map[int]int, error) {
+	parents := map[int]int{}
+	if len(ids) == 0 {
+		return parents, nil
+	}
+
+	idList := make([]int64, 0, len(ids))
+	for id := range ids {
+		idList = append(idList, int64(id))
+	}
+
+	rows, err := h.db.Query(`SELECT id, project_id FROM tasks WHERE id = ANY($1)`, pq.Array(idList))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, projectID int
+		if err := rows.Scan(&id, &projectID); err != nil {
+			return nil, err
+		}
+		parents[id] = projectID
+	}
+	return parents, rows.Err()
+}
+
+// insertImport inserts the valid rows in batches, each in its own
+// transaction, and records the outcome on report. A row that fails is rolled
+// back on its own. If a batch cannot be saved, the import stops and every row
+// from that batch on is reported as not imported.
+func (h *TaskHandler) insertImport(actorID int, rows []*importRow, report *models.TaskImportReport) {
+	for start := 0; start < len(rows); start += taskImportBatch {
+		end := start + taskImportBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		inserted, failures, err := h.insertImportBatch(actorID, rows[start:end])
+		if err != nil {
+			message := fmt.Sprintf("Not imported because the batch starting at line %d could not be saved", rows[start].line)
+			for _, row := range rows[start:] {
+				report.Errors = append(report.Errors, models.TaskImportError{Line: row.line, Error: message})
+			}
+			report.Failed += len(rows) - start
+			return
+		}
+		report.Inserted += inserted
+		report.Failed += len(failures)
+		report.Errors = append(report.Errors, failures...)
+	}
+}
+
+// insertImportBatch inserts rows in one transaction, with each row under a
+// savepoint. Rows that fail are returned; err is only set if the batch could
+// not be saved at all.
+func (h *TaskHandler) insertImportBatch(actorID int, rows []*importRow) (int, []models.TaskImportError, error) {
+	tx, err := beginActorTx(h.db, actorID)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	inserted := 0
+	var failures []models.TaskImportError
+	for _, row := range rows {
+		if _, err := tx.Exec("SAVEPOINT task_import_row"); err != nil {
+			return 0, nil, err
+		}
+
+		release := "RELEASE SAVEPOINT task_import_row"
+		if _, err := h.createTask(tx, row.req); err != nil {
+			result := failBulkError(models.BulkTaskResult{}, err, "Project")
+			failures = append(failures, models.TaskImportError{Line: row.line, Error: result.Error})
+			release = "ROLLBACK TO SAVEPOINT task_import_row"
+		} else {
+			inserted++
+		}
+		if _, err := tx.Exec(release); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return inserted, failures, nil
+}
+
+// respondImport writes the report over the hijacked connection, since a large
+// import can take longer than the server's write timeout
+func respondImport(c *gin.Context, status int, report models.TaskImportReport) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write import report"})
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Set("Connection", "close")
+
+	conn, buf, ok := hijackResponse(c, status)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	(&deadlineWriter{conn: conn, w: buf}).Write(body)
+}
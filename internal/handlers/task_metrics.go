@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsInterval describes a supported aggregation interval
+type metricsInterval struct {
+	// width is the time_bucket width
+	width string
+	// view is the continuous aggregate materializing task counts at this width
+	view string
+}
+
+var metricsIntervals = map[string]metricsInterval{
+	"hour":  {width: "1 hour", view: "task_metrics_hourly"},
+	"day":   {width: "1 day", view: "task_metrics_daily"},
+	"week":  {width: "1 week", view: "task_metrics_weekly"},
+	"month": {width: "1 month", view: "task_metrics_monthly"},
+}
+
+// GetMetricSnapshots retrieves the stored task metrics series
+// @Summary Get task metric snapshots
+// @Description Get the task counts recorded by the background snapshotter. Each bucket reports the latest snapshot in it; without project_id, visible projects are summed.
+// @Tags metrics
+// @Produce json
+// @Security BearerAuth
+// @Param from_date query string true "From date (YYYY-MM-DD)"
+// @Param to_date query string true "To date (YYYY-MM-DD)"
+// @Param project_id query int false "Filter by project ID"
+// @Param interval query string false "Aggregation interval (hour, day, week, month)" default(day)
+// @Success 200 {array} models.TaskMetrics
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/metrics/snapshots [get]
+func (h *TaskHandler) GetMetricSnapshots(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var query models.MetricsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Interval == "" {
+		query.Interval = "day"
+	}
+
+	interval, ok := metricsIntervals[query.Interval]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval"})
+		return
+	}
+
+	whereClause := "WHERE timestamp >= $1 AND timestamp <= $2"
+	args := []interface{}{query.FromDate, query.ToDate}
+
+	if query.ProjectID != nil {
+		if err := h.authz.RequireProject(subject, *query.ProjectID, authz.AccessRead); err != nil {
+			respondAuthzError(c, err, "Project")
+			return
+		}
+		args = append(args, *query.ProjectID)
+		whereClause += " AND project_id = $" + strconv.Itoa(len(args))
+	} else if condition, conditionArgs := h.authz.VisibleProjectsCondition(subject, "project_id", len(args)+1); condition != "" {
+		whereClause += " AND " + condition
+		args = append(args, conditionArgs...)
+	}
+
+	// Take the latest snapshot of each project per bucket, then sum across projects.
+	// The average completion time is weighted by each project's completed tasks.
+	queryStr := `
+		SELECT
+			bucket,
+			SUM(total_tasks),
+			SUM(completed_tasks),
+			SUM(in_progress_tasks),
+			SUM(overdue_tasks),
+			SUM(avg_completion_time * completed_tasks) / NULLIF(SUM(completed_tasks) FILTER (WHERE avg_completion_time IS NOT NULL), 0)
+		FROM (
+			SELECT
+				time_bucket('` + interval.width + `', timestamp) AS bucket,
+				project_id,
+				last(total_tasks, timestamp) AS total_tasks,
+				last(completed_tasks, timestamp) AS completed_tasks,
+				last(in_progress_tasks, timestamp) AS in_progress_tasks,
+				last(overdue_tasks, timestamp) AS overdue_tasks,
+				last(avg_completion_time, timestamp) AS avg_completion_time
+			FROM task_metrics
+			` + whereClause + `
+			GROUP BY bucket, project_id
+		) latest
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	rows, err := h.db.Query(queryStr, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query metric snapshots"})
+		return
+	}
+	defer rows.Close()
+
+	metrics := []models.TaskMetrics{}
+	for rows.Next() {
+		var metric models.TaskMetrics
+		err := rows.Scan(
+			&metric.Timestamp, &metric.TotalTasks, &metric.CompletedTasks,
+			&metric.InProgressTasks, &metric.OverdueTasks, &metric.AvgCompletionTime,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan metric snapshot"})
+			return
+		}
+		metric.ProjectID = query.ProjectID
+		metrics = append(metrics, metric)
+	}
+
+	c.JSON(http.StatusOK, metrics)
+}
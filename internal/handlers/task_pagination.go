@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"scalable-task-api/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTaskPageSize = 50
+	maxTaskPageSize     = 200
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// taskSortColumns lists the columns GET /tasks can be sorted by
+var taskSortColumns = map[string]bool{
+	"id":         true,
+	"title":      true,
+	"status":     true,
+	"priority":   true,
+	"created_at": true,
+	"updated_at": true,
+	"due_date":   true,
+}
+
+// taskRelevanceSort orders search results by rank. It is only available, and
+// is the default, when the request has a search term.
+const taskRelevanceSort = "relevance"
+
+// normalizeTaskSort falls back to the default sort for unknown columns or orders
+func normalizeTaskSort(sortBy, sortOrder string, searching bool) (string, string) {
+	if searching && (sortBy == "" || sortBy == taskRelevanceSort) {
+		sortBy = taskRelevanceSort
+	} else if !taskSortColumns[sortBy] {
+		sortBy = "created_at"
+	}
+	if sortOrder != "asc" && sortOrder != "desc" {
+		sortOrder = "desc"
+	}
+	return sortBy, sortOrder
+}
+
+// taskCursor is the decoded form of an opaque GET /tasks page cursor. It holds
+// the sort key of the last task on the previous page; id breaks ties.
+type taskCursor struct {
+	SortBy    string      `json:"s"`
+	SortOrder string      `json:"o"`
+	Value     interface{} `json:"v"`
+	ID        int         `json:"id"`
+}
+
+// encodeTaskCursor builds the cursor pointing just past task
+func encodeTaskCursor(sortBy, sortOrder string, task models.Task) string {
+	cursor := taskCursor{
+		SortBy:    sortBy,
+		SortOrder: sortOrder,
+		Value:     taskSortValue(task, sortBy),
+		ID:        task.ID,
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTaskCursor parses a cursor and checks it was issued for the same sort
+func decodeTaskCursor(encoded, sortBy, sortOrder string) (taskCursor, error) {
+	var cursor taskCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+
+	// Keep numbers as their literal text so integers round-trip exactly
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return cursor, errInvalidCursor
+	}
+
+	if cursor.SortBy != sortBy || cursor.SortOrder != sortOrder {
+		return cursor, errInvalidCursor
+	}
+
+	if number, ok := cursor.Value.(json.Number); ok {
+		cursor.Value = number.String()
+	}
+
+	return cursor, nil
+}
+
+// taskSortValue returns the value of the sort column for task, or nil if it is NULL
+func taskSortValue(task models.Task, sortBy string) interface{} {
+	switch sortBy {
+	case "title":
+		return task.Title
+	case "status":
+		return task.Status
+	case "priority":
+		return task.Priority
+	case "created_at":
+		return task.CreatedAt
+	case "updated_at":
+		return task.UpdatedAt
+	case "due_date":
+		if task.DueDate == nil {
+			return nil
+		}
+		return *task.DueDate
+	case taskRelevanceSort:
+		if task.SearchRank == nil {
+			return nil
+		}
+		return *task.SearchRank
+	}
+	return nil
+}
+
+// buildTaskCursorCondition returns the predicate selecting the rows after
+// cursor, with arguments numbered from argIndex. column is the SQL expression
+// of the sort key. It mirrors buildTaskOrderClause, which sorts NULLs last and
+// breaks ties by id.
+func buildTaskCursorCondition(cursor taskCursor, column string, argIndex int) (string, []interface{}) {
+	cmp := ">"
+	if cursor.SortOrder == "desc" {
+		cmp = "<"
+	}
+
+	idArg := "$" + strconv.Itoa(argIndex)
+	if cursor.SortBy == "id" {
+		return "id " + cmp + " " + idArg, []interface{}{cursor.ID}
+	}
+
+	if cursor.Value == nil {
+		return "(" + column + " IS NULL AND id " + cmp + " " + idArg + ")", []interface{}{cursor.ID}
+	}
+
+	valueArg := "$" + strconv.Itoa(argIndex+1)
+	return "(" + column + " " + cmp + " " + valueArg +
+		" OR (" + column + " = " + valueArg + " AND id " + cmp + " " + idArg + ")" +
+		" OR " + column + " IS NULL)", []interface{}{cursor.ID, cursor.Value}
+}
+
+// setTaskPageLinks sets an RFC 5988 Link header with the first and, if there
+// is one, the next page of the current request
+func setTaskPageLinks(c *gin.Context, nextCursor *string) {
+	pageURL := func(cursor string) string {
+		u := *c.Request.URL
+		q := u.Query()
+		q.Del("cursor")
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+
+	links := `<` + pageURL("") + `>; rel="first"`
+	if nextCursor != nil {
+		links += `, <` + pageURL(*nextCursor) + `>; rel="next"`
+	}
+	c.Header("Link", links)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// taskSearchHeadlineOptions configures the snippets returned for search matches
+const taskSearchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+// taskSearchExpr builds the tsquery expression for a GET /tasks search term,
+// with arguments numbered from argIndex. Quoted phrases, OR and -negation
+// follow websearch_to_tsquery; a trailing * turns a word into a prefix match.
+// It returns an empty expression if q contains no searchable words.
+func taskSearchExpr(q string, argIndex int) (string, []interface{}) {
+	var words []string
+	var prefixes []string
+
+	inQuote := false
+	for _, field := range strings.Fields(q) {
+		if strings.Count(field, `"`)%2 == 1 {
+			inQuote = !inQuote
+		}
+		if !inQuote && strings.HasSuffix(field, "*") && !strings.ContainsAny(field, `"`) {
+			if term := sanitizeSearchTerm(field); term != "" {
+				if strings.HasPrefix(field, "-") {
+					term = "!" + term
+				}
+				prefixes = append(prefixes, term+":*")
+				continue
+			}
+		}
+		words = append(words, field)
+	}
+
+	var parts []string
+	var args []interface{}
+
+	if text := strings.Join(words, " "); strings.IndexFunc(text, isSearchRune) >= 0 {
+		args = append(args, text)
+		parts = append(parts, "websearch_to_tsquery('english', $"+strconv.Itoa(argIndex+len(args)-1)+")")
+	}
+
+	if len(prefixes) > 0 {
+		args = append(args, strings.Join(prefixes, " & "))
+		parts = append(parts, "to_tsquery('english', $"+strconv.Itoa(argIndex+len(args)-1)+")")
+	}
+
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(parts, " && ") + ")", args
+}
+
+// sanitizeSearchTerm strips everything but letters and digits so the term can
+// be embedded in to_tsquery syntax
+func sanitizeSearchTerm(term string) string {
+	return strings.Map(func(r rune) rune {
+		if isSearchRune(r) {
+			return r
+		}
+		return -1
+	}, term)
+}
+
+func isSearchRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// leafTaskCondition matches tasks in the outer query that have no subtasks
+const leafTaskCondition = `NOT EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = tasks.id)`
+
+// checkTaskParent checks that parentID can become the parent of a task in
+// projectID. taskID is the task being moved, or 0 for a new task, which cannot
+// close a cycle. It returns errInvalidParent if the parent is missing or in
+// another project and errParentCycle if it lies in the task's own subtree.
+func checkTaskParent(tx *sql.Tx, taskID, projectID, parentID int) error {
+	if taskID != 0 {
+		if parentID == taskID {
+			return errParentCycle
+		}
+		// Serialize moves so two concurrent ones cannot close a cycle that
+		// neither transaction sees on its own
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('task_parents'))`); err != nil {
+			return err
+		}
+	}
+
+	var parentProjectID int
+	err := tx.QueryRow(`SELECT project_id FROM tasks WHERE id = $1 FOR KEY SHARE`, parentID).Scan(&parentProjectID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errInvalidParent
+		}
+		return err
+	}
+	if parentProjectID != projectID {
+		return errInvalidParent
+	}
+
+	if taskID == 0 {
+		return nil
+	}
+
+	var inSubtree bool
+	err = tx.QueryRow(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM tasks WHERE id = $1
+			UNION ALL
+			SELECT t.id, t.parent_id FROM tasks t JOIN ancestors a ON t.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+	`, parentID, taskID).Scan(&inSubtree)
+	if err != nil {
+		return err
+	}
+	if inSubtree {
+		return errParentCycle
+	}
+	return nil
+}
+
+// loadTaskTree loads a task and all of its descendants and computes their
+// rollups. It returns sql.ErrNoRows if the task does not exist.
+func (h *TaskHandler) loadTaskTree(id int) (models.TaskNode, error) {
+	rows, err := h.db.Query(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM tasks WHERE id = $1
+			UNION ALL
+			SELECT t.id FROM tasks t JOIN subtree s ON t.parent_id = s.id
+		)
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE id IN (SELECT id FROM subtree)
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return models.TaskNode{}, err
+	}
+	defer rows.Close()
+
+	tasks := map[int]models.Task{}
+	children := map[int][]int{}
+	for rows.Next() {
+		var task models.Task
+		if err := rows.Scan(taskScanFields(&task)...); err != nil {
+			return models.TaskNode{}, err
+		}
+		tasks[task.ID] = task
+		if task.ParentID != nil && task.ID != id {
+			children[*task.ParentID] = append(children[*task.ParentID], task.ID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return models.TaskNode{}, err
+	}
+
+	if _, ok := tasks[id]; !ok {
+		return models.TaskNode{}, sql.ErrNoRows
+	}
+	return buildTaskNode(id, tasks, children), nil
+}
+
+// buildTaskNode assembles the subtree rooted at id and rolls its hours and
+// progress up from the leaves
+func buildTaskNode(id int, tasks map[int]models.Task, children map[int][]int) models.TaskNode {
+	node := models.TaskNode{Task: tasks[id]}
+	rollup := &node.Rollup
+
+	if node.EstimatedHours != nil {
+		rollup.EstimatedHours = *node.EstimatedHours
+	}
+	if node.ActualHours != nil {
+		rollup.ActualHours = *node.ActualHours
+	}
+
+	for _, childID := range children[id] {
+		child := buildTaskNode(childID, tasks, children)
+		rollup.EstimatedHours += child.Rollup.EstimatedHours
+		rollup.ActualHours += child.Rollup.ActualHours
+		rollup.Subtasks += child.Rollup.Subtasks + 1
+		rollup.LeafTasks += child.Rollup.LeafTasks
+		rollup.DoneLeafTasks += child.Rollup.DoneLeafTasks
+		node.Children = append(node.Children, child)
+	}
+
+	if len(node.Children) == 0 && node.Status != string(models.TaskStatusCancelled) {
+		rollup.LeafTasks = 1
+		if node.CompletedAt != nil {
+			rollup.DoneLeafTasks = 1
+		}
+	}
+
+	switch {
+	case rollup.LeafTasks > 0:
+		rollup.PercentComplete = float64(rollup.DoneLeafTasks) * 100 / float64(rollup.LeafTasks)
+	case node.CompletedAt != nil:
+		rollup.PercentComplete = 100
+	}
+
+	return node
+}
+
+// GetSubtasks retrieves the direct subtasks of a task
+// @Summary Get subtasks
+// @Description Get the direct subtasks of a task, each with hours and percent-complete rolled up from its own subtasks
+// @Tags tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {array} models.TaskNode
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/subtasks [get]
+func (h *TaskHandler) GetSubtasks(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, id, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	root, err := h.loadTaskTree(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get subtasks"})
+		return
+	}
+
+	subtasks := make([]models.TaskNode, len(root.Children))
+	for i, child := range root.Children {
+		child.Children = nil
+		subtasks[i] = child
+	}
+
+	c.JSON(http.StatusOK, subtasks)
+}
+
+// GetTaskTree retrieves a task with all of its subtasks
+// @Summary Get task tree
+// @Description Get a task and its subtasks nested to any depth. Every node carries estimated and actual hours summed over its subtree and the percentage of its leaf tasks that are done.
+// @Tags tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.TaskNode
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/tree [get]
+func (h *TaskHandler) GetTaskTree(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, id, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	root, err := h.loadTaskTree(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get task tree"})
+		return
+	}
+
+	c.JSON(http.StatusOK, root)
+}
@@ -3,8 +3,10 @@ package handlers
 import (
         "database/sql"
         "net/http"
+        "scalable-task-api/internal/authz"
         "scalable-task-api/internal/models"
         "scalable-task-api/internal/monitoring"
+        "scalable-task-api/internal/storage"
         "strconv"
         "strings"
 
@@ -16,13 +18,17 @@ import (
 type TaskHandler struct {
         db      *sql.DB
         metrics *monitoring.Metrics
+        authz   *authz.Authorizer
+        blobs   storage.BlobStore
 }
 
 // NewTaskHandler creates a new task handler
-func NewTaskHandler(db *sql.DB, metrics *monitoring.Metrics) *TaskHandler {
+func NewTaskHandler(db *sql.DB, metrics *monitoring.Metrics, authorizer *authz.Authorizer, blobs storage.BlobStore) *TaskHandler {
         return &TaskHandler{
                 db:      db,
                 metrics: metrics,
+                authz:   authorizer,
+                blobs:   blobs,
         }
 }
 
@@ -37,30 +43,53 @@ func NewTaskHandler(db *sql.DB, metrics *monitoring.Metrics) *TaskHandler {
 // @Success 201 {object} models.Task
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
 // @Router /tasks [post]
 func (h *TaskHandler) CreateTask(c *gin.Context) {
+        subject, ok := currentSubject(c)
+        if !ok {
+                return
+        }
+
         var req models.CreateTaskRequest
         if err := c.ShouldBindJSON(&req); err != nil {
                 c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
                 return
         }
 
-        // Insert task
-        var task models.Task
-        err := h.db.QueryRow(`
-                INSERT INTO tasks (title, description, status, priority, assignee_id, project_id, due_date, estimated_hours, tags)
-                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-                RETURNING id, title, description, status, priority, assignee_id, project_id, created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags
-        `, req.Title, req.Description, req.Status, req.Priority, req.AssigneeID, req.ProjectID, req.DueDate, req.EstimatedHours, pq.Array(req.Tags)).Scan(
-                &task.ID, &task.Title, &task.Description, &task.Status, &task.Priority,
-                &task.AssigneeID, &task.ProjectID, &task.CreatedAt, &task.UpdatedAt,
-                &task.CompletedAt, &task.DueDate, &task.EstimatedHours, &task.ActualHours, pq.Array(&task.Tags),
-        )
+        if err := h.authz.RequireProject(subject, req.ProjectID, authz.AccessWrite); err != nil {
+                respondAuthzError(c, err, "Project")
+                return
+        }
 
+        tx, err := beginActorTx(h.db, subject.UserID)
         if err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
                 return
         }
+        defer tx.Rollback()
+
+        // Insert task
+        task, err := h.createTask(tx, req)
+        if err != nil {
+                if statusErr, ok := err.(*statusError); ok {
+                        respondStatusError(c, statusErr)
+                        return
+                }
+                if err == errInvalidParent {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "Parent task not found in this project"})
+                        return
+                }
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+                return
+        }
+
+        if err := tx.Commit(); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+                return
+        }
 
         // Update metrics
         h.updateTaskMetrics()
@@ -70,10 +99,11 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 
 // GetTasks retrieves tasks with filtering and pagination
 // @Summary Get tasks
-// @Description Get tasks with optional filtering and pagination
+// @Description Get tasks with optional filtering and cursor-based pagination. Follow next_cursor (or the Link header) to fetch the next page.
 // @Tags tasks
 // @Produce json
 // @Security BearerAuth
+// @Param q query string false "Full-text search over title and description. Supports \"quoted phrases\", OR, -negation and prefix* matches"
 // @Param status query []string false "Filter by status"
 // @Param assignee_id query int false "Filter by assignee ID"
 // @Param project_id query int false "Filter by project ID"
@@ -81,15 +111,23 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 // @Param from_date query string false "Filter from date (YYYY-MM-DD)"
 // @Param to_date query string false "Filter to date (YYYY-MM-DD)"
 // @Param tags query []string false "Filter by tags"
-// @Param limit query int false "Limit results" default(50)
-// @Param offset query int false "Offset results" default(0)
-// @Param sort_by query string false "Sort by field" default(created_at)
+// @Param blocked query bool false "Only tasks with (true) or without (false) open blockers"
+// @Param limit query int false "Page size (max 200)" default(50)
+// @Param cursor query string false "Cursor from a previous page's next_cursor"
+// @Param include_total query bool false "Include the total number of matching tasks" default(false)
+// @Param sort_by query string false "Sort by field; relevance (the default when q is set) is only available when searching" default(created_at)
 // @Param sort_order query string false "Sort order (asc/desc)" default(desc)
-// @Success 200 {array} models.Task
+// @Success 200 {object} models.TaskPage
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Router /tasks [get]
 func (h *TaskHandler) GetTasks(c *gin.Context) {
+        subject, ok := currentSubject(c)
+        if !ok {
+                return
+        }
+
         var query models.TaskQuery
         if err := c.ShouldBindQuery(&query); err != nil {
                 c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -97,27 +135,76 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
         }
 
         // Set defaults
-        if query.Limit == 0 {
-                query.Limit = 50
+        if query.Limit <= 0 {
+                query.Limit = defaultTaskPageSize
         }
-        if query.SortBy == "" {
-                query.SortBy = "created_at"
+        if query.Limit > maxTaskPageSize {
+                query.Limit = maxTaskPageSize
         }
-        if query.SortOrder == "" {
-                query.SortOrder = "desc"
+
+        searchExpr, _ := taskSearchExpr(query.Q, 1)
+        query.SortBy, query.SortOrder = normalizeTaskSort(query.SortBy, query.SortOrder, searchExpr != "")
+
+        if query.ProjectID != nil {
+                if err := h.authz.RequireProject(subject, *query.ProjectID, authz.AccessRead); err != nil {
+                        respondAuthzError(c, err, "Project")
+                        return
+                }
         }
 
         // Build query
-        whereClause, args := h.buildTaskWhereClause(query)
+        whereClause, args := h.buildTaskWhereClause(subject, query)
         orderClause := h.buildTaskOrderClause(query.SortBy, query.SortOrder)
 
+        page := models.TaskPage{Data: []models.Task{}}
+
+        if query.IncludeTotal {
+                var total int
+                if err := h.db.QueryRow(`SELECT COUNT(*) FROM tasks`+whereClause, args...).Scan(&total); err != nil {
+                        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count tasks"})
+                        return
+                }
+                page.TotalCount = &total
+        }
+
+        if query.Cursor != "" {
+                cursor, err := decodeTaskCursor(query.Cursor, query.SortBy, query.SortOrder)
+                if err != nil {
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+                        return
+                }
+                // The rank alias cannot be referenced in WHERE, so compare the expression itself
+                sortColumn := query.SortBy
+                if sortColumn == taskRelevanceSort {
+                        sortColumn = "ts_rank_cd(search_vector, " + searchExpr + ")"
+                }
+                condition, cursorArgs := buildTaskCursorCondition(cursor, sortColumn, len(args)+1)
+                if whereClause == "" {
+                        whereClause = " WHERE " + condition
+                } else {
+                        whereClause += " AND " + condition
+                }
+                args = append(args, cursorArgs...)
+        }
+
+        // Search results also carry their rank and highlighted snippets. The
+        // search expression's arguments are always the first in args.
+        searchColumns := ""
+        if searchExpr != "" {
+                searchColumns = `,
+                       ts_rank_cd(search_vector, ` + searchExpr + `) AS search_rank,
+                       ts_headline('english', title, ` + searchExpr + `, '` + taskSearchHeadlineOptions + `'),
+                       ts_headline('english', COALESCE(description, ''), ` + searchExpr + `, '` + taskSearchHeadlineOptions + `')`
+        }
+
+        // Fetch one extra row to find out whether there is a next page
         queryStr := `
                 SELECT id, title, description, status, priority, assignee_id, project_id, 
-                       created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags
+                       created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags, parent_id` + searchColumns + `
                 FROM tasks
-        ` + whereClause + orderClause + ` LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+        ` + whereClause + orderClause + ` LIMIT $` + strconv.Itoa(len(args)+1)
 
-        args = append(args, query.Limit, query.Offset)
+        args = append(args, query.Limit+1)
 
         rows, err := h.db.Query(queryStr, args...)
         if err != nil {
@@ -126,22 +213,32 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
         }
         defer rows.Close()
 
-        var tasks []models.Task
         for rows.Next() {
                 var task models.Task
-                err := rows.Scan(
+                fields := []interface{}{
                         &task.ID, &task.Title, &task.Description, &task.Status, &task.Priority,
                         &task.AssigneeID, &task.ProjectID, &task.CreatedAt, &task.UpdatedAt,
-                        &task.CompletedAt, &task.DueDate, &task.EstimatedHours, &task.ActualHours, pq.Array(&task.Tags),
-                )
-                if err != nil {
+                        &task.CompletedAt, &task.DueDate, &task.EstimatedHours, &task.ActualHours, pq.Array(&task.Tags), &task.ParentID,
+                }
+                if searchExpr != "" {
+                        task.Highlights = &models.TaskHighlights{}
+                        fields = append(fields, &task.SearchRank, &task.Highlights.Title, &task.Highlights.Description)
+                }
+                if err := rows.Scan(fields...); err != nil {
                         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan task"})
                         return
                 }
-                tasks = append(tasks, task)
+                page.Data = append(page.Data, task)
         }
 
-        c.JSON(http.StatusOK, tasks)
+        if len(page.Data) > query.Limit {
+                page.Data = page.Data[:query.Limit]
+                next := encodeTaskCursor(query.SortBy, query.SortOrder, page.Data[query.Limit-1])
+                page.NextCursor = &next
+        }
+
+        setTaskPageLinks(c, page.NextCursor)
+        c.JSON(http.StatusOK, page)
 }
 
 // GetTask retrieves a single task by ID
@@ -157,6 +254,11 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 // @Failure 404 {object} map[string]string
 // @Router /tasks/{id} [get]
 func (h *TaskHandler) GetTask(c *gin.Context) {
+        subject, ok := currentSubject(c)
+        if !ok {
+                return
+        }
+
         idStr := c.Param("id")
         id, err := strconv.Atoi(idStr)
         if err != nil {
@@ -164,15 +266,20 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
                 return
         }
 
+        if _, err := h.authz.RequireTask(subject, id, authz.AccessRead); err != nil {
+                respondAuthzError(c, err, "Task")
+                return
+        }
+
         var task models.Task
         err = h.db.QueryRow(`
                 SELECT id, title, description, status, priority, assignee_id, project_id, 
-                       created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags
+                       created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags, parent_id
                 FROM tasks WHERE id = $1
         `, id).Scan(
                 &task.ID, &task.Title, &task.Description, &task.Status, &task.Priority,
                 &task.AssigneeID, &task.ProjectID, &task.CreatedAt, &task.UpdatedAt,
-                &task.CompletedAt, &task.DueDate, &task.EstimatedHours, &task.ActualHours, pq.Array(&task.Tags),
+                &task.CompletedAt, &task.DueDate, &task.EstimatedHours, &task.ActualHours, pq.Array(&task.Tags), &task.ParentID,
         )
 
         if err != nil {
@@ -189,7 +296,7 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 
 // UpdateTask updates an existing task
 // @Summary Update task
-// @Description Update an existing task
+// @Description Update an existing task. Status changes must be allowed by the project's workflow, and a task cannot move to in_progress or done while it has open blockers unless override_blockers is set. actual_hours is derived from work logs and cannot be set.
 // @Tags tasks
 // @Accept json
 // @Produce json
@@ -199,9 +306,17 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 // @Success 200 {object} models.Task
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
+// @Failure 422 {object} map[string]interface{}
 // @Router /tasks/{id} [put]
 func (h *TaskHandler) UpdateTask(c *gin.Context) {
+        subject, ok := currentSubject(c)
+        if !ok {
+                return
+        }
+
         idStr := c.Param("id")
         id, err := strconv.Atoi(idStr)
         if err != nil {
@@ -209,45 +324,52 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
                 return
         }
 
+        if _, err := h.authz.RequireTask(subject, id, authz.AccessWrite); err != nil {
+                respondAuthzError(c, err, "Task")
+                return
+        }
+
         var req models.UpdateTaskRequest
         if err := c.ShouldBindJSON(&req); err != nil {
                 c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
                 return
         }
 
-        // Build update query dynamically
-        updateClause, args := h.buildTaskUpdateClause(req)
-        if len(args) == 0 {
-                c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+        tx, err := beginActorTx(h.db, subject.UserID)
+        if err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
                 return
         }
+        defer tx.Rollback()
 
-        // Add completion timestamp if status is changed to done
-        if req.Status != nil && *req.Status == "done" {
-                updateClause += ", completed_at = NOW()"
-        }
-
-        query := `
-                UPDATE tasks SET ` + updateClause + `, updated_at = NOW()
-                WHERE id = $` + strconv.Itoa(len(args)+1) + `
-                RETURNING id, title, description, status, priority, assignee_id, project_id, 
-                          created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags
-        `
-
-        args = append(args, id)
-
-        var task models.Task
-        err = h.db.QueryRow(query, args...).Scan(
-                &task.ID, &task.Title, &task.Description, &task.Status, &task.Priority,
-                &task.AssigneeID, &task.ProjectID, &task.CreatedAt, &task.UpdatedAt,
-                &task.CompletedAt, &task.DueDate, &task.EstimatedHours, &task.ActualHours, pq.Array(&task.Tags),
-        )
-
+        task, err := h.updateTask(tx, id, req)
         if err != nil {
-                if err == sql.ErrNoRows {
-                        c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+                if statusErr, ok := err.(*statusError); ok {
+                        respondStatusError(c, statusErr)
+                        return
+                }
+                if blockedErr, ok := err.(*blockedError); ok {
+                        respondBlockedError(c, blockedErr)
                         return
                 }
+                switch err {
+                case errNoFieldsToUpdate:
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+                case errActualHoursDerived:
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "actual_hours is the sum of the task's work logs and cannot be set"})
+                case errInvalidParent:
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "Parent task not found in this project"})
+                case errParentCycle:
+                        c.JSON(http.StatusBadRequest, gin.H{"error": "A task cannot be moved under itself or one of its subtasks"})
+                case sql.ErrNoRows:
+                        c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+                default:
+                        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
+                }
+                return
+        }
+
+        if err := tx.Commit(); err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update task"})
                 return
         }
@@ -260,16 +382,23 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 
 // DeleteTask deletes a task
 // @Summary Delete task
-// @Description Delete a task by ID
+// @Description Delete a task by ID. Its subtasks either move up to the task's parent or are deleted with it. Attachment content no longer used by any task is removed.
 // @Tags tasks
 // @Security BearerAuth
 // @Param id path int true "Task ID"
+// @Param children query string false "What happens to subtasks (reparent, cascade)" default(reparent)
 // @Success 204
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /tasks/{id} [delete]
 func (h *TaskHandler) DeleteTask(c *gin.Context) {
+        subject, ok := currentSubject(c)
+        if !ok {
+                return
+        }
+
         idStr := c.Param("id")
         id, err := strconv.Atoi(idStr)
         if err != nil {
@@ -277,23 +406,42 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
                 return
         }
 
-        result, err := h.db.Exec("DELETE FROM tasks WHERE id = $1", id)
+        var query models.DeleteTaskQuery
+        if err := c.ShouldBindQuery(&query); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+        }
+
+        if _, err := h.authz.RequireTask(subject, id, authz.AccessWrite); err != nil {
+                respondAuthzError(c, err, "Task")
+                return
+        }
+
+        tx, err := beginActorTx(h.db, subject.UserID)
         if err != nil {
                 c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
                 return
         }
+        defer tx.Rollback()
 
-        rowsAffected, err := result.RowsAffected()
+        blobs, err := h.deleteTask(tx, id, query.Children)
         if err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+                if err == sql.ErrNoRows {
+                        c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+                        return
+                }
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
                 return
         }
 
-        if rowsAffected == 0 {
-                c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+        if err := tx.Commit(); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
                 return
         }
 
+        // Remove attachment content no other task uses
+        collectBlobs(h.db, h.blobs, blobs)
+
         // Update metrics
         h.updateTaskMetrics()
 
@@ -302,7 +450,7 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 
 // GetTaskMetrics retrieves task metrics for time-series analysis
 // @Summary Get task metrics
-// @Description Get aggregated task metrics for time-series analysis
+// @Description Get aggregated task metrics for time-series analysis, served from continuous aggregates with a raw-data fallback for the not yet materialized window
 // @Tags metrics
 // @Produce json
 // @Security BearerAuth
@@ -310,56 +458,108 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 // @Param to_date query string true "To date (YYYY-MM-DD)"
 // @Param project_id query int false "Filter by project ID"
 // @Param interval query string false "Aggregation interval (hour, day, week, month)" default(day)
+// @Param leaf_only query bool false "Only count tasks without subtasks (computed from raw data)" default(false)
 // @Success 200 {array} models.TaskMetrics
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Router /tasks/metrics [get]
 func (h *TaskHandler) GetTaskMetrics(c *gin.Context) {
+        subject, ok := currentSubject(c)
+        if !ok {
+                return
+        }
+
         var query models.MetricsQuery
         if err := c.ShouldBindQuery(&query); err != nil {
                 c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
                 return
         }
 
+        if query.ProjectID != nil {
+                if err := h.authz.RequireProject(subject, *query.ProjectID, authz.AccessRead); err != nil {
+                        respondAuthzError(c, err, "Project")
+                        return
+                }
+        }
+
         if query.Interval == "" {
                 query.Interval = "day"
         }
 
-        // Build time bucket based on interval
-        var timeBucket string
-        switch query.Interval {
-        case "hour":
-                timeBucket = "time_bucket('1 hour', created_at)"
-        case "day":
-                timeBucket = "time_bucket('1 day', created_at)"
-        case "week":
-                timeBucket = "time_bucket('1 week', created_at)"
-        case "month":
-                timeBucket = "time_bucket('1 month', created_at)"
-        default:
+        interval, ok := metricsIntervals[query.Interval]
+        if !ok {
                 c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval"})
                 return
         }
 
-        whereClause := "WHERE created_at >= $1 AND created_at <= $2"
+        // Buckets are whole intervals: the first bucket starts at or before from_date
+        timeBucket := "time_bucket('" + interval.width + "', created_at)"
         args := []interface{}{query.FromDate, query.ToDate}
 
+        projectCondition := ""
         if query.ProjectID != nil {
-                whereClause += " AND project_id = $3"
+                projectCondition = " AND project_id = $3"
                 args = append(args, *query.ProjectID)
+        } else if condition, conditionArgs := h.authz.VisibleProjectsCondition(subject, "project_id", len(args)+1); condition != "" {
+                projectCondition = " AND " + condition
+                args = append(args, conditionArgs...)
         }
 
+        watermark := `SELECT COALESCE(MAX(bucket) + INTERVAL '` + interval.width + `', '-infinity') AS cutoff
+                        FROM ` + interval.view
+        rawCondition := projectCondition
+
+        // A task stops being a leaf when a subtask is added, which the aggregates
+        // can't follow, so leaf-only metrics are computed from the raw table
+        if query.LeafOnly {
+                watermark = `SELECT '-infinity'::timestamptz AS cutoff`
+                rawCondition += " AND " + leafTaskCondition
+        }
+
+        // Completed buckets come from the continuous aggregate. Tasks created after
+        // its last materialized bucket are aggregated from the raw table. Overdue
+        // counts depend on the current time, so they can't be materialized and are
+        // always computed from the (indexed) set of past-due open tasks.
         queryStr := `
-                SELECT 
-                        ` + timeBucket + ` as timestamp,
-                        COUNT(*) as total_tasks,
-                        COUNT(*) FILTER (WHERE status = 'done') as completed_tasks,
-                        COUNT(*) FILTER (WHERE status = 'in_progress') as in_progress_tasks,
-                        COUNT(*) FILTER (WHERE due_date < NOW() AND status != 'done') as overdue_tasks,
-                        AVG(EXTRACT(EPOCH FROM (completed_at - created_at))/3600) FILTER (WHERE completed_at IS NOT NULL) as avg_completion_time
-                FROM tasks 
-                ` + whereClause + `
-                GROUP BY ` + timeBucket + `
+                WITH watermark AS (
+                        ` + watermark + `
+                )
+                SELECT
+                        bucket as timestamp,
+                        SUM(total_tasks) as total_tasks,
+                        SUM(completed_tasks) as completed_tasks,
+                        SUM(in_progress_tasks) as in_progress_tasks,
+                        SUM(overdue_tasks) as overdue_tasks,
+                        SUM(completion_hours_sum) / NULLIF(SUM(completion_count), 0) as avg_completion_time
+                FROM (
+                        SELECT bucket, total_tasks, completed_tasks, in_progress_tasks, 0 AS overdue_tasks,
+                               completion_hours_sum, completion_count
+                        FROM ` + interval.view + `, watermark
+                        WHERE bucket >= time_bucket('` + interval.width + `', $1::timestamptz) AND bucket <= $2
+                          AND bucket < watermark.cutoff` + projectCondition + `
+
+                        UNION ALL
+
+                        SELECT ` + timeBucket + `, COUNT(*), COUNT(*) FILTER (WHERE completed_at IS NOT NULL),
+                               COUNT(*) FILTER (WHERE status = 'in_progress'), 0,
+                               SUM(EXTRACT(EPOCH FROM (completed_at - created_at))/3600) FILTER (WHERE completed_at IS NOT NULL),
+                               COUNT(*) FILTER (WHERE completed_at IS NOT NULL)
+                        FROM tasks, watermark
+                        WHERE created_at >= GREATEST(time_bucket('` + interval.width + `', $1::timestamptz), watermark.cutoff)
+                          AND created_at <= $2` + rawCondition + `
+                        GROUP BY 1
+
+                        UNION ALL
+
+                        SELECT ` + timeBucket + `, 0, 0, 0, COUNT(*), NULL, 0
+                        FROM tasks
+                        WHERE due_date < NOW() AND completed_at IS NULL
+                          AND created_at >= time_bucket('` + interval.width + `', $1::timestamptz)
+                          AND created_at <= $2` + rawCondition + `
+                        GROUP BY 1
+                ) combined
+                GROUP BY bucket
                 ORDER BY timestamp
         `
 
@@ -392,11 +592,19 @@ func (h *TaskHandler) GetTaskMetrics(c *gin.Context) {
 
 // Helper functions
 
-func (h *TaskHandler) buildTaskWhereClause(query models.TaskQuery) (string, []interface{}) {
+func (h *TaskHandler) buildTaskWhereClause(subject authz.Subject, query models.TaskQuery) (string, []interface{}) {
         var conditions []string
         var args []interface{}
         argIndex := 1
 
+        // The search expression comes first so GetTasks can reuse its
+        // placeholders for ranking and highlighting
+        if expr, searchArgs := taskSearchExpr(query.Q, argIndex); expr != "" {
+                conditions = append(conditions, "search_vector @@ "+expr)
+                args = append(args, searchArgs...)
+                argIndex += len(searchArgs)
+        }
+
         if len(query.Status) > 0 {
                 placeholders := make([]string, len(query.Status))
                 for i, status := range query.Status {
@@ -443,6 +651,21 @@ func (h *TaskHandler) buildTaskWhereClause(query models.TaskQuery) (string, []in
                 argIndex++
         }
 
+        if query.Blocked != nil {
+                if *query.Blocked {
+                        conditions = append(conditions, blockedTaskCondition)
+                } else {
+                        conditions = append(conditions, "NOT "+blockedTaskCondition)
+                }
+        }
+
+        // Only return tasks from projects the caller can see
+        if condition, conditionArgs := h.authz.VisibleProjectsCondition(subject, "project_id", argIndex); condition != "" {
+                conditions = append(conditions, condition)
+                args = append(args, conditionArgs...)
+                argIndex += len(conditionArgs)
+        }
+
         whereClause := ""
         if len(conditions) > 0 {
                 whereClause = " WHERE " + strings.Join(conditions, " AND ")
@@ -452,25 +675,14 @@ func (h *TaskHandler) buildTaskWhereClause(query models.TaskQuery) (string, []in
 }
 
 func (h *TaskHandler) buildTaskOrderClause(sortBy, sortOrder string) string {
-        validColumns := map[string]bool{
-                "id":          true,
-                "title":       true,
-                "status":      true,
-                "priority":    true,
-                "created_at":  true,
-                "updated_at":  true,
-                "due_date":    true,
-        }
-
-        if !validColumns[sortBy] {
-                sortBy = "created_at"
-        }
-
-        if sortOrder != "asc" && sortOrder != "desc" {
-                sortOrder = "desc"
-        }
-
-        return " ORDER BY " + sortBy + " " + sortOrder
+        // id breaks ties so that keyset pagination has a total order
+        switch sortBy {
+        case "id":
+                return " ORDER BY id " + sortOrder
+        case taskRelevanceSort:
+                return " ORDER BY search_rank " + sortOrder + ", id " + sortOrder
+        }
+        return " ORDER BY " + sortBy + " " + sortOrder + " NULLS LAST, id " + sortOrder
 }
 
 func (h *TaskHandler) buildTaskUpdateClause(req models.UpdateTaskRequest) (string, []interface{}) {
@@ -508,6 +720,16 @@ func (h *TaskHandler) buildTaskUpdateClause(req models.UpdateTaskRequest) (strin
                 argIndex++
         }
 
+        if req.ParentID != nil {
+                setParts = append(setParts, "parent_id = $"+strconv.Itoa(argIndex))
+                if *req.ParentID == 0 {
+                        args = append(args, nil)
+                } else {
+                        args = append(args, *req.ParentID)
+                }
+                argIndex++
+        }
+
         if req.DueDate != nil {
                 setParts = append(setParts, "due_date = $"+strconv.Itoa(argIndex))
                 args = append(args, *req.DueDate)
@@ -520,12 +742,6 @@ func (h *TaskHandler) buildTaskUpdateClause(req models.UpdateTaskRequest) (strin
                 argIndex++
         }
 
-        if req.ActualHours != nil {
-                setParts = append(setParts, "actual_hours = $"+strconv.Itoa(argIndex))
-                args = append(args, *req.ActualHours)
-                argIndex++
-        }
-
         if req.Tags != nil {
                 setParts = append(setParts, "tags = $"+strconv.Itoa(argIndex))
                 args = append(args, pq.Array(req.Tags))
@@ -535,6 +751,185 @@ func (h *TaskHandler) buildTaskUpdateClause(req models.UpdateTaskRequest) (strin
         return strings.Join(setParts, ", "), args
 }
 
+const taskColumns = `id, title, description, status, priority, assignee_id, project_id,
+        created_at, updated_at, completed_at, due_date, estimated_hours, actual_hours, tags, parent_id`
+
+// taskScanFields returns the scan destinations matching taskColumns
+func taskScanFields(task *models.Task) []interface{} {
+        return []interface{}{
+                &task.ID, &task.Title, &task.Description, &task.Status, &task.Priority,
+                &task.AssigneeID, &task.ProjectID, &task.CreatedAt, &task.UpdatedAt,
+                &task.CompletedAt, &task.DueDate, &task.EstimatedHours, &task.ActualHours, pq.Array(&task.Tags), &task.ParentID,
+        }
+}
+
+// CreateTaskTx inserts a task within tx with the same validation as
+// CreateTask. Background jobs use it to create tasks outside a request.
+func (h *TaskHandler) CreateTaskTx(tx *sql.Tx, req models.CreateTaskRequest) (models.Task, error) {
+        return h.createTask(tx, req)
+}
+
+// createTask inserts a task within tx
+func (h *TaskHandler) createTask(tx *sql.Tx, req models.CreateTaskRequest) (models.Task, error) {
+        var task models.Task
+
+        workflow, err := loadWorkflow(tx, req.ProjectID, true)
+        if err != nil {
+                return task, err
+        }
+
+        // New tasks start in the workflow's initial status unless told otherwise
+        if req.Status == "" {
+                req.Status = workflow.InitialStatus
+        }
+        if !workflow.HasStatus(req.Status) {
+                return task, &statusError{message: "Invalid status: " + req.Status, allowed: workflow.Statuses}
+        }
+
+        if req.ParentID != nil {
+                if err := checkTaskParent(tx, 0, req.ProjectID, *req.ParentID); err != nil {
+                        return task, err
+                }
+        }
+
+        err = tx.QueryRow(`
+                INSERT INTO tasks (title, description, status, priority, assignee_id, project_id, due_date, estimated_hours, tags, parent_id, completed_at)
+                VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CASE WHEN $11 THEN NOW() END)
+                RETURNING `+taskColumns,
+                req.Title, req.Description, req.Status, req.Priority, req.AssigneeID, req.ProjectID, req.DueDate, req.EstimatedHours, pq.Array(req.Tags), req.ParentID,
+                workflow.IsCompleted(req.Status),
+        ).Scan(taskScanFields(&task)...)
+        return task, err
+}
+
+// updateTask applies req to a task within tx. It returns sql.ErrNoRows if the
+// task does not exist and errNoFieldsToUpdate if req is empty.
+func (h *TaskHandler) updateTask(tx *sql.Tx, id int, req models.UpdateTaskRequest) (models.Task, error) {
+        var task models.Task
+
+        if req.ActualHours != nil {
+                return task, errActualHoursDerived
+        }
+
+        // Build update query dynamically
+        updateClause, args := h.buildTaskUpdateClause(req)
+        if len(args) == 0 {
+                return task, errNoFieldsToUpdate
+        }
+
+        if req.ParentID != nil && *req.ParentID != 0 {
+                var projectID int
+                if err := tx.QueryRow(`SELECT project_id FROM tasks WHERE id = $1`, id).Scan(&projectID); err != nil {
+                        return task, err
+                }
+                if err := checkTaskParent(tx, id, projectID, *req.ParentID); err != nil {
+                        return task, err
+                }
+        }
+
+        // Status changes must follow the project's workflow. completed_at is
+        // set when a task enters one of the workflow's completed statuses and
+        // cleared when it leaves them.
+        if req.Status != nil {
+                var current string
+                var projectID int
+                err := tx.QueryRow(`SELECT status, project_id FROM tasks WHERE id = $1 FOR UPDATE`, id).Scan(&current, &projectID)
+                if err != nil {
+                        return task, err
+                }
+
+                workflow, err := loadWorkflow(tx, projectID, true)
+                if err != nil {
+                        return task, err
+                }
+                if !workflow.CanTransition(current, *req.Status) {
+                        return task, &statusError{
+                                message: "Invalid status transition from " + current + " to " + *req.Status,
+                                allowed: workflow.NextStatuses(current),
+                        }
+                }
+
+                // Tasks cannot be started or finished while their blockers are open
+                if *req.Status != current && requiresUnblocked(workflow, *req.Status) && !req.OverrideBlockers {
+                        blockers, err := openBlockers(tx, id)
+                        if err != nil {
+                                return task, err
+                        }
+                        if len(blockers) > 0 {
+                                return task, &blockedError{blockers: blockers}
+                        }
+                }
+
+                if workflow.IsCompleted(*req.Status) && !workflow.IsCompleted(current) {
+                        updateClause += ", completed_at = NOW()"
+                } else if !workflow.IsCompleted(*req.Status) && workflow.IsCompleted(current) {
+                        updateClause += ", completed_at = NULL"
+                }
+        }
+
+        query := `
+                UPDATE tasks SET ` + updateClause + `, updated_at = NOW()
+                WHERE id = $` + strconv.Itoa(len(args)+1) + `
+                RETURNING ` + taskColumns
+
+        args = append(args, id)
+
+        err := tx.QueryRow(query, args...).Scan(taskScanFields(&task)...)
+        return task, err
+}
+
+// deleteTask deletes a task within tx, handling its subtasks as children
+// says (re-parenting them by default). It returns the blobs used by the
+// deleted tasks' attachments, to be passed to collectBlobs once tx commits,
+// and sql.ErrNoRows if the task does not exist.
+func (h *TaskHandler) deleteTask(tx *sql.Tx, id int, children string) ([]string, error) {
+        ids := pq.Int64Array{int64(id)}
+        if children == models.DeleteChildrenCascade {
+                err := tx.QueryRow(`
+                        WITH RECURSIVE subtree AS (
+                                SELECT id FROM tasks WHERE id = $1
+                                UNION ALL
+                                SELECT t.id FROM tasks t JOIN subtree s ON t.parent_id = s.id
+                        )
+                        SELECT COALESCE(array_agg(id), '{}') FROM subtree
+                `, id).Scan(&ids)
+                if err != nil {
+                        return nil, err
+                }
+        } else {
+                _, err := tx.Exec(`
+                        UPDATE tasks SET parent_id = (SELECT parent_id FROM tasks WHERE id = $1), updated_at = NOW()
+                        WHERE parent_id = $1
+                `, id)
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        var blobs pq.StringArray
+        err := tx.QueryRow(`
+                SELECT COALESCE(array_agg(DISTINCT blob_hash), '{}') FROM task_attachments WHERE task_id = ANY($1)
+        `, ids).Scan(&blobs)
+        if err != nil {
+                return nil, err
+        }
+
+        result, err := tx.Exec("DELETE FROM tasks WHERE id = ANY($1)", ids)
+        if err != nil {
+                return nil, err
+        }
+
+        rowsAffected, err := result.RowsAffected()
+        if err != nil {
+                return nil, err
+        }
+
+        if rowsAffected == 0 {
+                return nil, sql.ErrNoRows
+        }
+        return blobs, nil
+}
+
 func (h *TaskHandler) updateTaskMetrics() {
         // Query current task counts by status
         rows, err := h.db.Query(`
@@ -556,10 +951,11 @@ func (h *TaskHandler) updateTaskMetrics() {
                 }
         }
 
-        // Update active tasks count
+        // Update active tasks count: those neither completed nor cancelled,
+        // whatever statuses their project's workflow uses
         var activeCount int
         err = h.db.QueryRow(`
-                SELECT COUNT(*) FROM tasks WHERE status IN ('todo', 'in_progress', 'review')
+                SELECT COUNT(*) FROM tasks WHERE ` + openTaskCondition("tasks") + `
         `).Scan(&activeCount)
         if err == nil {
                 h.metrics.UpdateActiveTasksMetric(float64(activeCount))
@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/auth"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const userColumns = `id, username, email, COALESCE(full_name, ''), COALESCE(role, 'user'), created_at, updated_at`
+
+// UserHandler handles user management endpoints
+type UserHandler struct {
+	db     *sql.DB
+	tokens *auth.TokenStore
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(db *sql.DB, tokens *auth.TokenStore) *UserHandler {
+	return &UserHandler{
+		db:     db,
+		tokens: tokens,
+	}
+}
+
+// CreateUser creates a new user
+// @Summary Create a user
+// @Description Create a new user account. The caller must have every permission of the role they give (user:admin permission required).
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateUserRequest true "User information"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users [post]
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = string(models.UserRoleUser)
+	}
+	if !checkRole(c, h.db, &subject, req.Role) {
+		return
+	}
+
+	user, err := insertUser(h.db, req.Username, req.Email, req.Password, req.FullName, req.Role)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username or email already in use"})
+			return
+		}
+		if isUnknownRole(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + req.Role})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// GetUsers lists users
+// @Summary Get users
+// @Description List users with optional search and role filter (user:admin permission required)
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Search username, email or full name"
+// @Param role query string false "Filter by role"
+// @Param limit query int false "Limit results" default(50)
+// @Param offset query int false "Offset results" default(0)
+// @Success 200 {array} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /users [get]
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	var query models.UserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit <= 0 || query.Limit > 200 {
+		query.Limit = 50
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	if query.Q != "" {
+		args = append(args, likePattern(query.Q))
+		n := strconv.Itoa(len(args))
+		conditions = append(conditions, "(username ILIKE $"+n+" OR email ILIKE $"+n+" OR full_name ILIKE $"+n+")")
+	}
+
+	if query.Role != "" {
+		args = append(args, query.Role)
+		conditions = append(conditions, "role = $"+strconv.Itoa(len(args)))
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	queryStr := `SELECT ` + userColumns + ` FROM users` + whereClause +
+		` ORDER BY username LIMIT $` + strconv.Itoa(len(args)+1) + ` OFFSET $` + strconv.Itoa(len(args)+2)
+	args = append(args, query.Limit, query.Offset)
+
+	rows, err := h.db.Query(queryStr, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(
+			&user.ID, &user.Username, &user.Email, &user.FullName, &user.Role,
+			&user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user"})
+			return
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser retrieves a single user by ID
+// @Summary Get user by ID
+// @Description Get a single user by ID (user:admin permission required)
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id} [get]
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	err = h.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser updates a user
+// @Summary Update user
+// @Description Update a user's email, name, role or password. Changing the role or password signs the user out everywhere. The caller must have every permission of the user's current and new role (user:admin permission required).
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body models.UpdateUserRequest true "User update information"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users/{id} [put]
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if !h.canManageUser(c, subject, id) {
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields := map[string]interface{}{}
+	if req.Email != nil {
+		fields["email"] = *req.Email
+	}
+	if req.FullName != nil {
+		fields["full_name"] = *req.FullName
+	}
+	if req.Role != nil {
+		if !checkRole(c, h.db, &subject, *req.Role) {
+			return
+		}
+		fields["role"] = *req.Role
+	}
+	if req.Password != nil {
+		hash, err := auth.HashPassword(*req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		fields["password_hash"] = hash
+	}
+
+	user, err := updateUser(h.db, id, fields)
+	if err != nil {
+		respondUserUpdateError(c, err)
+		return
+	}
+
+	// Sessions started with the old password or role end with it
+	if req.Role != nil || req.Password != nil {
+		if err := h.tokens.RevokeUser(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end user's sessions"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser deletes a user
+// @Summary Delete user
+// @Description Delete a user. Their tasks are unassigned and their sessions end; users that still own projects cannot be deleted (user:admin permission required).
+// @Tags users
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users/{id} [delete]
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if id == c.GetInt("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+
+	subject, ok := currentSubject(c)
+	if !ok || !h.canManageUser(c, subject, id) {
+		return
+	}
+
+	tx, err := beginActorTx(h.db, c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE tasks SET assignee_id = NULL, updated_at = NOW() WHERE assignee_id = $1`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unassign user's tasks"})
+		return
+	}
+
+	// Their refresh tokens go with them, and access tokens of users who no
+	// longer exist are rejected by AuthMiddleware
+	result, err := tx.Exec(`DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "User still owns projects; transfer them first"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SearchDirectory searches the user directory
+// @Summary Search user directory
+// @Description Search users by username or full name, e.g. for an assignee picker
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Search term"
+// @Param limit query int false "Limit results" default(20)
+// @Success 200 {array} models.UserSummary
+// @Failure 401 {object} map[string]string
+// @Router /users/directory [get]
+func (h *UserHandler) SearchDirectory(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, username, COALESCE(full_name, '')
+		FROM users
+		WHERE username ILIKE $1 OR full_name ILIKE $1
+		ORDER BY username
+		LIMIT $2
+	`, likePattern(c.Query("q")), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.UserSummary{}
+	for rows.Next() {
+		var user models.UserSummary
+		if err := rows.Scan(&user.ID, &user.Username, &user.FullName); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user"})
+			return
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// Helper functions
+
+// canManageUser checks that the subject has every permission of a user's
+// role, so nobody can take over or remove a user with more permissions than
+// they have. It writes the error response if not.
+func (h *UserHandler) canManageUser(c *gin.Context, subject authz.Subject, id int) bool {
+	var permissions []string
+	err := h.db.QueryRow(`
+		SELECT COALESCE(r.permissions, '{}')
+		FROM users u
+		LEFT JOIN roles r ON r.name = u.role
+		WHERE u.id = $1
+	`, id).Scan(pq.Array(&permissions))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return false
+	}
+
+	if !hasPermissions(subject, permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot manage a user with permissions you do not have"})
+		return false
+	}
+	return true
+}
+
+// insertUser hashes the password and creates a new user row
+func insertUser(db *sql.DB, username, email, password, fullName, role string) (models.User, error) {
+	var user models.User
+
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return user, err
+	}
+
+	err = db.QueryRow(`
+		INSERT INTO users (username, email, password_hash, full_name, role)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+userColumns,
+		username, email, passwordHash, fullName, role,
+	).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	return user, err
+}
+
+// updateUser sets the given columns on a user row. Column names come from
+// handler code only, never from the request. Changing the email address
+// marks it unverified, so single sign-on no longer links to the account by
+// that address.
+func updateUser(db *sql.DB, id int, fields map[string]interface{}) (models.User, error) {
+	var user models.User
+
+	if len(fields) == 0 {
+		return user, errNoFieldsToUpdate
+	}
+
+	var setParts []string
+	var args []interface{}
+	for _, column := range []string{"email", "full_name", "role", "password_hash"} {
+		if value, ok := fields[column]; ok {
+			args = append(args, value)
+			setParts = append(setParts, column+" = $"+strconv.Itoa(len(args)))
+			if column == "email" {
+				setParts = append(setParts, "email_verified = email_verified AND lower(email) = lower($"+strconv.Itoa(len(args))+")")
+			}
+		}
+	}
+	args = append(args, id)
+
+	err := db.QueryRow(`
+		UPDATE users SET `+strings.Join(setParts, ", ")+`, updated_at = NOW()
+		WHERE id = $`+strconv.Itoa(len(args))+`
+		RETURNING `+userColumns,
+		args...,
+	).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FullName, &user.Role,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	return user, err
+}
+
+// respondUserUpdateError maps an updateUser error to an HTTP response
+func respondUserUpdateError(c *gin.Context, err error) {
+	switch {
+	case err == errNoFieldsToUpdate:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case isUniqueViolation(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+	case isUnknownRole(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+	}
+}
+
+// likePattern turns a search term into a substring ILIKE pattern
+func likePattern(term string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+	return "%" + escaped + "%"
+}
@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"scalable-task-api/internal/webhook"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const webhookColumns = `id, owner_id, url, event_types, project_ids, active, consecutive_failures,
+	disabled_at, disabled_reason, created_at, updated_at`
+
+// webhookScanFields returns the scan destinations matching webhookColumns
+func webhookScanFields(webhook *models.Webhook) []interface{} {
+	return []interface{}{
+		&webhook.ID, &webhook.OwnerID, &webhook.URL, pq.Array(&webhook.EventTypes), pq.Array(&webhook.ProjectIDs),
+		&webhook.Active, &webhook.ConsecutiveFailures, &webhook.DisabledAt, &webhook.DisabledReason,
+		&webhook.CreatedAt, &webhook.UpdatedAt,
+	}
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_attempt_at, response_status, last_error, created_at`
+
+// webhookDeliveryScanFields returns the scan destinations matching webhookDeliveryColumns
+func webhookDeliveryScanFields(delivery *models.WebhookDelivery) []interface{} {
+	return []interface{}{
+		&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Payload,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastAttemptAt,
+		&delivery.ResponseStatus, &delivery.LastError, &delivery.CreatedAt,
+	}
+}
+
+// WebhookHandler handles webhook subscription endpoints. Deliveries are
+// queued by the database and sent by webhook.Dispatcher.
+type WebhookHandler struct {
+	db           *sql.DB
+	authz        *authz.Authorizer
+	allowPrivate bool
+}
+
+// NewWebhookHandler creates a new webhook handler. Unless allowPrivate is
+// set, webhooks cannot point at loopback, private or link-local addresses.
+func NewWebhookHandler(db *sql.DB, authorizer *authz.Authorizer, allowPrivate bool) *WebhookHandler {
+	return &WebhookHandler{
+		db:           db,
+		authz:        authorizer,
+		allowPrivate: allowPrivate,
+	}
+}
+
+// GetWebhooks lists the caller's webhooks
+// @Summary Get webhooks
+// @Description Get the caller's webhooks. Admins see every webhook.
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Webhook
+// @Failure 401 {object} map[string]string
+// @Router /webhooks [get]
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+webhookColumns+`
+		FROM webhooks
+		WHERE owner_id = $1 OR $2
+		ORDER BY id
+	`, subject.UserID, subject.IsAdmin())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query webhooks"})
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var webhook models.Webhook
+		if err := rows.Scan(webhookScanFields(&webhook)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan webhook"})
+			return
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhook subscribes a URL to task events
+// @Summary Create webhook
+// @Description Subscribe a URL to task events in the given projects, which the caller must own. Only admins may leave project_ids empty to subscribe to every project. Events stop being delivered once the owner loses that access. Each delivery is a JSON POST signed with the returned secret: X-Webhook-Signature is "sha256=" followed by the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>". The secret is only shown in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateWebhookRequest true "Webhook information"
+// @Success 201 {object} models.Webhook
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.validWebhookURL(c, req.URL) || !validWebhookEvents(c, req.EventTypes) {
+		return
+	}
+	if req.ProjectIDs == nil {
+		req.ProjectIDs = []int64{}
+	}
+	if !h.canSubscribe(c, subject, req.ProjectIDs) {
+		return
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	var webhook models.Webhook
+	err = h.db.QueryRow(`
+		INSERT INTO webhooks (owner_id, url, secret, event_types, project_ids)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+webhookColumns,
+		subject.UserID, req.URL, secret, pq.Array(req.EventTypes), pq.Array(req.ProjectIDs),
+	).Scan(webhookScanFields(&webhook)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+	webhook.Secret = secret
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// GetWebhook retrieves a webhook by ID
+// @Summary Get webhook
+// @Description Get a webhook by ID
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, ok := h.ownWebhook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook updates a webhook
+// @Summary Update webhook
+// @Description Update a webhook's URL, event types or projects, or turn it on and off. Turning on a webhook that was disabled after failing clears its failure count and resumes its pending deliveries.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param request body models.UpdateWebhookRequest true "Webhook updates"
+// @Success 200 {object} models.Webhook
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id} [put]
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	webhook, ok := h.ownWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var setParts []string
+	var args []interface{}
+	argIndex := 1
+
+	if req.URL != nil {
+		if !h.validWebhookURL(c, *req.URL) {
+			return
+		}
+		setParts = append(setParts, "url = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.URL)
+		argIndex++
+	}
+
+	if req.EventTypes != nil {
+		if !validWebhookEvents(c, req.EventTypes) {
+			return
+		}
+		setParts = append(setParts, "event_types = $"+strconv.Itoa(argIndex))
+		args = append(args, pq.Array(req.EventTypes))
+		argIndex++
+	}
+
+	if req.ProjectIDs != nil {
+		if !h.canSubscribe(c, subject, req.ProjectIDs) {
+			return
+		}
+		setParts = append(setParts, "project_ids = $"+strconv.Itoa(argIndex))
+		args = append(args, pq.Array(req.ProjectIDs))
+		argIndex++
+	}
+
+	if req.Active != nil {
+		setParts = append(setParts, "active = $"+strconv.Itoa(argIndex))
+		args = append(args, *req.Active)
+		argIndex++
+		if *req.Active {
+			setParts = append(setParts, "consecutive_failures = 0", "disabled_at = NULL", "disabled_reason = NULL")
+		}
+	}
+
+	if len(setParts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	setParts = append(setParts, "updated_at = NOW()")
+	args = append(args, webhook.ID)
+
+	err := h.db.QueryRow(`
+		UPDATE webhooks SET `+strings.Join(setParts, ", ")+`
+		WHERE id = $`+strconv.Itoa(argIndex)+`
+		RETURNING `+webhookColumns,
+		args...,
+	).Scan(webhookScanFields(&webhook)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook deletes a webhook and its delivery log
+// @Summary Delete webhook
+// @Description Delete a webhook, its delivery log and any deliveries not yet sent
+// @Tags webhooks
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhook, ok := h.ownWebhook(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.Exec(`DELETE FROM webhooks WHERE id = $1`, webhook.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries retrieves a webhook's delivery log
+// @Summary Get webhook deliveries
+// @Description Get the deliveries queued for and sent to a webhook, newest first
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param status query string false "Filter by status (pending, succeeded, failed)"
+// @Param limit query int false "Limit results" default(50)
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) GetWebhookDeliveries(c *gin.Context) {
+	webhook, ok := h.ownWebhook(c)
+	if !ok {
+		return
+	}
+
+	var query models.WebhookDeliveryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit <= 0 || query.Limit > 200 {
+		query.Limit = 50
+	}
+
+	switch query.Status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status: " + query.Status})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, webhook.ID, query.Status, query.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query deliveries"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := rows.Scan(webhookDeliveryScanFields(&delivery)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan delivery"})
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhookDelivery queues a delivery to be sent again
+// @Summary Redeliver webhook delivery
+// @Description Queue a new delivery of the same event and payload. The original delivery is kept in the log.
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Webhook ID"
+// @Param delivery_id path int true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (h *WebhookHandler) RedeliverWebhookDelivery(c *gin.Context) {
+	webhook, ok := h.ownWebhook(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	if !webhook.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook is disabled"})
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	err = h.db.QueryRow(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+		SELECT webhook_id, event_id, event_type, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING `+webhookDeliveryColumns,
+		deliveryID, webhook.ID,
+	).Scan(webhookDeliveryScanFields(&delivery)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue delivery"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// ownWebhook loads the webhook named by the id parameter if the caller owns
+// it or is an admin, writing the error response otherwise
+func (h *WebhookHandler) ownWebhook(c *gin.Context) (models.Webhook, bool) {
+	var webhook models.Webhook
+
+	subject, ok := currentSubject(c)
+	if !ok {
+		return webhook, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return webhook, false
+	}
+
+	err = h.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id).Scan(webhookScanFields(&webhook)...)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook"})
+		return webhook, false
+	}
+
+	// Other users' webhooks are reported as missing
+	if err == sql.ErrNoRows || !subject.IsAdmin() && (webhook.OwnerID == nil || *webhook.OwnerID != subject.UserID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return webhook, false
+	}
+
+	return webhook, true
+}
+
+// canSubscribe checks that the subject may receive events from the given
+// projects, writing the error response if not. No projects means all of
+// them, which only admins may subscribe to, and not with an API key.
+func (h *WebhookHandler) canSubscribe(c *gin.Context, subject authz.Subject, projectIDs []int64) bool {
+	if len(projectIDs) == 0 && (!subject.IsAdmin() || subject.Scope != nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can subscribe to all projects"})
+		return false
+	}
+
+	for _, projectID := range projectIDs {
+		if err := h.authz.RequireProject(subject, int(projectID), authz.AccessOwner); err != nil {
+			respondAuthzError(c, err, "Project")
+			return false
+		}
+	}
+	return true
+}
+
+// validWebhookURL checks that rawURL is an absolute http or https URL that
+// does not name an internal host, writing the error response if not
+func (h *WebhookHandler) validWebhookURL(c *gin.Context, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must be an absolute http or https URL"})
+		return false
+	}
+	if err := webhook.CheckURL(rawURL, h.allowPrivate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must not point at a loopback, private or link-local address"})
+		return false
+	}
+	return true
+}
+
+// validWebhookEvents checks that every event type is known, writing the
+// error response if not
+func validWebhookEvents(c *gin.Context, eventTypes []string) bool {
+	for _, eventType := range eventTypes {
+		known := false
+		for _, t := range models.WebhookEventTypes {
+			if eventType == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event type: " + eventType, "allowed_event_types": models.WebhookEventTypes})
+			return false
+		}
+	}
+	return true
+}
+
+// generateWebhookSecret returns a random secret for signing deliveries
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,635 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const workLogColumns = `id, task_id, user_id, started_at, duration_seconds, duration_seconds IS NULL,
+	note, created_at, updated_at`
+
+// workLogScanFields returns the scan destinations matching workLogColumns
+func workLogScanFields(log *models.WorkLog) []interface{} {
+	return []interface{}{
+		&log.ID, &log.TaskID, &log.UserID, &log.StartedAt, &log.DurationSeconds, &log.Running,
+		&log.Note, &log.CreatedAt, &log.UpdatedAt,
+	}
+}
+
+// WorkLogHandler handles time tracking endpoints
+type WorkLogHandler struct {
+	db    *sql.DB
+	authz *authz.Authorizer
+}
+
+// NewWorkLogHandler creates a new work log handler
+func NewWorkLogHandler(db *sql.DB, authorizer *authz.Authorizer) *WorkLogHandler {
+	return &WorkLogHandler{
+		db:    db,
+		authz: authorizer,
+	}
+}
+
+// GetTaskWorkLogs retrieves the time entries of a task
+// @Summary Get task work logs
+// @Description Get the time entries logged on a task, newest first. The task's actual_hours is the sum of its finished entries.
+// @Tags worklogs
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param from query string false "Only entries started at or after this time (RFC 3339)"
+// @Param to query string false "Only entries started at or before this time (RFC 3339)"
+// @Param user_id query int false "Filter by user ID"
+// @Param limit query int false "Limit results" default(100)
+// @Success 200 {array} models.WorkLog
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/worklogs [get]
+func (h *WorkLogHandler) GetTaskWorkLogs(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var query models.WorkLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit <= 0 || query.Limit > 1000 {
+		query.Limit = 100
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	queryStr := `SELECT ` + workLogColumns + ` FROM work_logs WHERE task_id = $1`
+	args := []interface{}{taskID}
+
+	if query.From != nil {
+		args = append(args, *query.From)
+		queryStr += ` AND started_at >= $` + strconv.Itoa(len(args))
+	}
+
+	if query.To != nil {
+		args = append(args, *query.To)
+		queryStr += ` AND started_at <= $` + strconv.Itoa(len(args))
+	}
+
+	if query.UserID != nil {
+		args = append(args, *query.UserID)
+		queryStr += ` AND user_id = $` + strconv.Itoa(len(args))
+	}
+
+	args = append(args, query.Limit)
+	queryStr += ` ORDER BY started_at DESC, id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := h.db.Query(queryStr, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query work logs"})
+		return
+	}
+	defer rows.Close()
+
+	logs := []models.WorkLog{}
+	for rows.Next() {
+		var log models.WorkLog
+		if err := rows.Scan(workLogScanFields(&log)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan work log"})
+			return
+		}
+		logs = append(logs, log)
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
+
+// CreateWorkLog logs time on a task
+// @Summary Create work log
+// @Description Log a finished time entry on a task for the authenticated user
+// @Tags worklogs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param request body models.CreateWorkLogRequest true "Time entry"
+// @Success 201 {object} models.WorkLog
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id}/worklogs [post]
+func (h *WorkLogHandler) CreateWorkLog(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var req models.CreateWorkLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, authz.AccessWrite); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create work log"})
+		return
+	}
+	defer tx.Rollback()
+
+	var log models.WorkLog
+	err = tx.QueryRow(`
+		INSERT INTO work_logs (task_id, user_id, started_at, duration_seconds, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+workLogColumns,
+		taskID, subject.UserID, req.StartedAt, req.DurationSeconds, req.Note,
+	).Scan(workLogScanFields(&log)...)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create work log"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create work log"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, log)
+}
+
+// StartTimer starts a running time entry on a task
+// @Summary Start timer
+// @Description Start a timer on a task for the authenticated user. A user can only have one running timer.
+// @Tags worklogs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param request body models.StartTimerRequest false "Timer note"
+// @Success 201 {object} models.WorkLog
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
+// @Router /tasks/{id}/worklogs/timer [post]
+func (h *WorkLogHandler) StartTimer(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	var req models.StartTimerRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := h.authz.RequireTask(subject, taskID, authz.AccessWrite); err != nil {
+		respondAuthzError(c, err, "Task")
+		return
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent starts cannot both see no running timer
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, subject.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+		return
+	}
+
+	running, err := runningTimer(tx, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+		return
+	}
+	if running != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A timer is already running", "work_log": running})
+		return
+	}
+
+	var log models.WorkLog
+	err = tx.QueryRow(`
+		INSERT INTO work_logs (task_id, user_id, started_at, note)
+		VALUES ($1, $2, NOW(), $3)
+		RETURNING `+workLogColumns,
+		taskID, subject.UserID, req.Note,
+	).Scan(workLogScanFields(&log)...)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, log)
+}
+
+// GetRunningTimer retrieves the caller's running timer
+// @Summary Get running timer
+// @Description Get the authenticated user's running timer, if any
+// @Tags worklogs
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.WorkLog
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /worklogs/timer [get]
+func (h *WorkLogHandler) GetRunningTimer(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	running, err := runningTimer(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get timer"})
+		return
+	}
+	if running == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No timer running"})
+		return
+	}
+
+	c.JSON(http.StatusOK, running)
+}
+
+// StopTimer stops the caller's running timer
+// @Summary Stop timer
+// @Description Stop the authenticated user's running timer, recording the time since it started
+// @Tags worklogs
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.WorkLog
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /worklogs/timer/stop [post]
+func (h *WorkLogHandler) StopTimer(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop timer"})
+		return
+	}
+	defer tx.Rollback()
+
+	var log models.WorkLog
+	err = tx.QueryRow(`
+		UPDATE work_logs
+		SET duration_seconds = GREATEST(1, CEIL(EXTRACT(EPOCH FROM NOW() - started_at)))::INTEGER, updated_at = NOW()
+		WHERE user_id = $1 AND duration_seconds IS NULL
+		RETURNING `+workLogColumns,
+		subject.UserID,
+	).Scan(workLogScanFields(&log)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No timer running"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop timer"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, log)
+}
+
+// UpdateWorkLog updates a time entry
+// @Summary Update work log
+// @Description Update a time entry. Only the user who logged it or an admin may change it. Setting a duration on a running timer stops it.
+// @Tags worklogs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Work log ID"
+// @Param request body models.UpdateWorkLogRequest true "Time entry changes"
+// @Success 200 {object} models.WorkLog
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /worklogs/{id} [put]
+func (h *WorkLogHandler) UpdateWorkLog(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid work log ID"})
+		return
+	}
+
+	var req models.UpdateWorkLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.StartedAt == nil && req.DurationSeconds == nil && req.Note == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update work log"})
+		return
+	}
+	defer tx.Rollback()
+
+	log, ok := h.lockOwnWorkLog(c, tx, subject, id)
+	if !ok {
+		return
+	}
+
+	if req.DurationSeconds != nil {
+		log.DurationSeconds = req.DurationSeconds
+	}
+	if req.Note != nil {
+		log.Note = *req.Note
+	}
+
+	// Entries are partitioned by started_at, so moving one to another start
+	// time re-inserts it under the same ID rather than updating in place
+	if req.StartedAt != nil && !req.StartedAt.Equal(log.StartedAt) {
+		if _, err := tx.Exec(`DELETE FROM work_logs WHERE id = $1`, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update work log"})
+			return
+		}
+		err = tx.QueryRow(`
+			INSERT INTO work_logs (id, task_id, user_id, started_at, duration_seconds, note, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+			RETURNING `+workLogColumns,
+			id, log.TaskID, log.UserID, *req.StartedAt, log.DurationSeconds, log.Note, log.CreatedAt,
+		).Scan(workLogScanFields(&log)...)
+	} else {
+		err = tx.QueryRow(`
+			UPDATE work_logs SET duration_seconds = $2, note = $3, updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+workLogColumns,
+			id, log.DurationSeconds, log.Note,
+		).Scan(workLogScanFields(&log)...)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update work log"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update work log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, log)
+}
+
+// DeleteWorkLog deletes a time entry
+// @Summary Delete work log
+// @Description Delete a time entry. Only the user who logged it or an admin may delete it.
+// @Tags worklogs
+// @Security BearerAuth
+// @Param id path int true "Work log ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /worklogs/{id} [delete]
+func (h *WorkLogHandler) DeleteWorkLog(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid work log ID"})
+		return
+	}
+
+	tx, err := beginActorTx(h.db, subject.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete work log"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, ok := h.lockOwnWorkLog(c, tx, subject, id); !ok {
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM work_logs WHERE id = $1`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete work log"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete work log"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetTimesheet retrieves the time a user logged over a date range
+// @Summary Get timesheet
+// @Description Get the time logged by a user between two dates (inclusive), totalled per day and task. Defaults to the authenticated user; only admins may view other users' timesheets.
+// @Tags worklogs
+// @Produce json
+// @Security BearerAuth
+// @Param from_date query string true "From date (YYYY-MM-DD)"
+// @Param to_date query string true "To date (YYYY-MM-DD), inclusive"
+// @Param user_id query int false "User ID (admins only)"
+// @Success 200 {object} models.Timesheet
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /worklogs/timesheet [get]
+func (h *WorkLogHandler) GetTimesheet(c *gin.Context) {
+	subject, ok := currentSubject(c)
+	if !ok {
+		return
+	}
+
+	var query models.TimesheetQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.ToDate.Before(query.FromDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to_date must not be before from_date"})
+		return
+	}
+
+	userID := subject.UserID
+	if query.UserID != nil && *query.UserID != subject.UserID {
+		if !subject.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+			return
+		}
+		userID = *query.UserID
+	}
+
+	queryStr := `
+		SELECT time_bucket('1 day', w.started_at) AS day, w.task_id, t.title, t.project_id, SUM(w.duration_seconds)
+		FROM work_logs w
+		JOIN tasks t ON t.id = w.task_id
+		WHERE w.user_id = $1 AND w.duration_seconds IS NOT NULL
+		  AND w.started_at >= $2 AND w.started_at < $3`
+	args := []interface{}{userID, query.FromDate, query.ToDate.AddDate(0, 0, 1)}
+
+	if condition, conditionArgs := h.authz.VisibleProjectsCondition(subject, "t.project_id", len(args)+1); condition != "" {
+		queryStr += " AND " + condition
+		args = append(args, conditionArgs...)
+	}
+	queryStr += `
+		GROUP BY day, w.task_id, t.title, t.project_id
+		ORDER BY day, w.task_id`
+
+	rows, err := h.db.Query(queryStr, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query timesheet"})
+		return
+	}
+	defer rows.Close()
+
+	timesheet := models.Timesheet{
+		UserID:   userID,
+		FromDate: query.FromDate.Format("2006-01-02"),
+		ToDate:   query.ToDate.Format("2006-01-02"),
+		Days:     []models.TimesheetDay{},
+	}
+	for rows.Next() {
+		var day time.Time
+		var entry models.TimesheetEntry
+		if err := rows.Scan(&day, &entry.TaskID, &entry.TaskTitle, &entry.ProjectID, &entry.Seconds); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan timesheet"})
+			return
+		}
+
+		date := day.UTC().Format("2006-01-02")
+		if n := len(timesheet.Days); n == 0 || timesheet.Days[n-1].Date != date {
+			timesheet.Days = append(timesheet.Days, models.TimesheetDay{Date: date, Entries: []models.TimesheetEntry{}})
+		}
+		current := &timesheet.Days[len(timesheet.Days)-1]
+		current.Entries = append(current.Entries, entry)
+		current.TotalSeconds += entry.Seconds
+		timesheet.TotalSeconds += entry.Seconds
+	}
+
+	c.JSON(http.StatusOK, timesheet)
+}
+
+// runningTimer returns the user's running time entry, or nil if there is none
+func runningTimer(q rowQuerier, userID int) (*models.WorkLog, error) {
+	var log models.WorkLog
+	err := q.QueryRow(`
+		SELECT `+workLogColumns+` FROM work_logs
+		WHERE user_id = $1 AND duration_seconds IS NULL
+		LIMIT 1
+	`, userID).Scan(workLogScanFields(&log)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &log, nil
+}
+
+// lockOwnWorkLog locks a time entry for update and checks that the subject
+// may change it: the user who logged it, with write access to its task, or an
+// admin. It writes the error response and returns false otherwise.
+func (h *WorkLogHandler) lockOwnWorkLog(c *gin.Context, tx *sql.Tx, subject authz.Subject, id int64) (models.WorkLog, bool) {
+	var log models.WorkLog
+	err := tx.QueryRow(`SELECT `+workLogColumns+` FROM work_logs WHERE id = $1 FOR UPDATE`, id).Scan(workLogScanFields(&log)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Work log not found"})
+			return log, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get work log"})
+		return log, false
+	}
+
+	if _, err := h.authz.RequireTask(subject, log.TaskID, authz.AccessRead); err != nil {
+		respondAuthzError(c, err, "Work log")
+		return log, false
+	}
+
+	if !subject.IsAdmin() {
+		if log.UserID == nil || *log.UserID != subject.UserID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the user who logged this time or an admin can change it"})
+			return log, false
+		}
+		if _, err := h.authz.RequireTask(subject, log.TaskID, authz.AccessWrite); err != nil {
+			respondAuthzError(c, err, "Work log")
+			return log, false
+		}
+	}
+
+	return log, true
+}
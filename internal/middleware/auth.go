@@ -1,16 +1,56 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"scalable-task-api/internal/auth"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware creates JWT authentication middleware
-func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
+// errTokenCheckFailed is returned by checkToken when the token's session or
+// user could not be read
+var errTokenCheckFailed = errors.New("failed to check token")
+
+// checkToken validates an access token, checks that neither it nor its
+// session has been revoked and returns the user's current role. Tokens
+// without an ID cannot be revoked and are rejected.
+func checkToken(jwtService *auth.JWTService, tokens *auth.TokenStore, tokenString string) (*auth.Claims, string, error) {
+	claims, err := jwtService.ValidateAccessToken(tokenString)
+	if err != nil {
+		return nil, "", err
+	}
+	if claims.ID == "" {
+		return nil, "", errors.New("token has no ID")
+	}
+
+	role, err := tokens.CurrentRole(claims)
+	if err != nil {
+		if err == auth.ErrAccessTokenRevoked {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("%w: %v", errTokenCheckFailed, err)
+	}
+	return claims, role, nil
+}
+
+// AuthMiddleware creates JWT authentication middleware. It also loads the
+// permissions of the user's global role. The role is read from the database
+// on every request rather than taken from the token, so role changes and
+// deleted users take effect at once.
+func AuthMiddleware(jwtService *auth.JWTService, tokens *auth.TokenStore, authorizer *authz.Authorizer) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API keys may be sent in their own header or as the bearer token
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, tokens, authorizer, key)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
@@ -28,10 +68,22 @@ func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
 		// Extract the token
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
+		if auth.IsAPIKey(tokenString) {
+			authenticateAPIKey(c, tokens, authorizer, tokenString)
+			return
+		}
+
 		// Validate the token
-		claims, err := jwtService.ValidateToken(tokenString)
+		claims, role, err := checkToken(jwtService, tokens, tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			switch {
+			case err == auth.ErrAccessTokenRevoked:
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			case errors.Is(err, errTokenCheckFailed):
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+			default:
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			}
 			c.Abort()
 			return
 		}
@@ -39,37 +91,142 @@ func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		c.Set("role", role)
+		c.Set("claims", claims)
+		if !setPermissions(c, authorizer, role) {
+			return
+		}
 
 		c.Next()
 	}
 }
 
+// authenticateAPIKey authenticates the request as an API key's user, limited
+// to the key's scope. Read-only keys may only make safe requests.
+func authenticateAPIKey(c *gin.Context, tokens *auth.TokenStore, authorizer *authz.Authorizer, key string) {
+	principal, err := tokens.AuthenticateAPIKey(key)
+	if err != nil {
+		if err == auth.ErrInvalidAPIKey {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check API key"})
+		}
+		c.Abort()
+		return
+	}
+
+	scope := &authz.Scope{ProjectIDs: principal.ProjectIDs, Access: authz.AccessWrite}
+	if principal.Permission == models.APIKeyPermissionRead {
+		scope.Access = authz.AccessRead
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "This API key is read-only"})
+			c.Abort()
+			return
+		}
+	}
+
+	// Set user information in context
+	c.Set("user_id", principal.UserID)
+	c.Set("username", principal.Username)
+	c.Set("role", principal.Role)
+	c.Set("api_key_id", principal.KeyID)
+	c.Set("scope", scope)
+	if !setPermissions(c, authorizer, principal.Role) {
+		return
+	}
+
+	c.Next()
+}
+
+// setPermissions stores the permissions of the user's global role in the
+// context, writing an error response if they cannot be loaded
+func setPermissions(c *gin.Context, authorizer *authz.Authorizer, role string) bool {
+	permissions, err := authorizer.RolePermissions(role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		c.Abort()
+		return false
+	}
+	c.Set("permissions", permissions)
+	return true
+}
+
+// StreamAuthMiddleware is AuthMiddleware that also accepts the token as the
+// access_token query parameter, for EventSource and WebSocket clients that
+// cannot set headers
+func StreamAuthMiddleware(jwtService *auth.JWTService, tokens *auth.TokenStore, authorizer *authz.Authorizer) gin.HandlerFunc {
+	authenticate := AuthMiddleware(jwtService, tokens, authorizer)
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		authenticate(c)
+	}
+}
+
 // OptionalAuthMiddleware creates optional JWT authentication middleware
-func OptionalAuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
+func OptionalAuthMiddleware(jwtService *auth.JWTService, tokens *auth.TokenStore, authorizer *authz.Authorizer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if claims, err := jwtService.ValidateToken(tokenString); err == nil {
+			if claims, role, err := checkToken(jwtService, tokens, tokenString); err == nil {
 				c.Set("user_id", claims.UserID)
 				c.Set("username", claims.Username)
-				c.Set("role", claims.Role)
+				c.Set("role", role)
+				c.Set("claims", claims)
+				if !setPermissions(c, authorizer, role) {
+					return
+				}
 			}
 		}
 		c.Next()
 	}
 }
 
-// RequireRole creates middleware that requires a specific role
-func RequireRole(role string) gin.HandlerFunc {
+// ProjectIDFunc finds the project a request is about, returning 0 if it is
+// not about a single project
+type ProjectIDFunc func(c *gin.Context) int
+
+// ProjectQuery finds the project in a query parameter
+func ProjectQuery(name string) ProjectIDFunc {
+	return func(c *gin.Context) int {
+		id, _ := strconv.Atoi(c.Query(name))
+		return id
+	}
+}
+
+// RequirePermission creates middleware that requires a permission, granted by
+// the user's global role or, if project finds the project the request is
+// about, by their role in that project. project may be nil for permissions
+// that are only granted globally.
+func RequirePermission(authorizer *authz.Authorizer, permission string, project ProjectIDFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("role")
-		if !exists || userRole != role {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		subject, ok := authz.SubjectFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
-		c.Next()
+
+		projectID := 0
+		if project != nil {
+			projectID = project(c)
+		}
+
+		switch err := authorizer.RequirePermission(subject, permission, projectID); err {
+		case nil:
+			c.Next()
+			return
+		case authz.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		case authz.ErrForbidden:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient privileges"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authorize request"})
+		}
+		c.Abort()
 	}
-}
\ No newline at end of file
+}
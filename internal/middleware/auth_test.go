@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"scalable-task-api/internal/auth"
+	"scalable-task-api/internal/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckToken(t *testing.T) {
+	const secret = "test-secret"
+	cfg := &config.JWTConfig{SecretKey: secret, TokenExpiration: time.Hour, RefreshExpiration: time.Hour}
+	jwtService, err := auth.NewJWTService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := jwtService.GenerateToken(1, "alice", "user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshUse, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		UserID:   1,
+		TokenUse: "refresh",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Issuer:    "scalable-task-api",
+		},
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		revoked bool
+		wantErr bool
+	}{
+		{name: "access token", token: access},
+		{name: "revoked access token", token: access, revoked: true, wantErr: true},
+		{name: "refresh token_use", token: refreshUse, wantErr: true},
+		{name: "opaque refresh token", token: "bm90LWEtand0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			// Only tokens that pass validation reach the database
+			if tt.token == access {
+				mock.ExpectQuery("SELECT COALESCE").
+					WillReturnRows(sqlmock.NewRows([]string{"role", "revoked"}).AddRow("admin", tt.revoked))
+			}
+
+			claims, role, err := checkToken(jwtService, auth.NewTokenStore(db, cfg), tt.token)
+			switch {
+			case tt.wantErr && err == nil:
+				t.Fatal("checkToken accepted the token")
+			case !tt.wantErr && err != nil:
+				t.Fatalf("checkToken failed: %v", err)
+			case !tt.wantErr && (claims.UserID != 1 || role != "admin"):
+				t.Fatalf("checkToken returned user %d with role %q, want 1 with the stored role", claims.UserID, role)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
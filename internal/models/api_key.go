@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// API key permissions
+const (
+	APIKeyPermissionRead  = "read"
+	APIKeyPermissionWrite = "write"
+)
+
+// APIKey is a long-lived credential that acts as its user, limited to
+// ProjectIDs (every project the user can access when empty) and to read or
+// write access. Key is only returned when the key is created; Prefix
+// identifies it afterwards.
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Key        string     `json:"key,omitempty" db:"-"`
+	ProjectIDs []int64    `json:"project_ids" db:"project_ids"`
+	Permission string     `json:"permission" db:"permission"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedBy  *int       `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CreateAPIKeyRequest represents the request payload for creating an API key.
+// Admins may set UserID to create a key for another user, such as a service
+// account.
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required,max=100"`
+	UserID     *int       `json:"user_id"`
+	ProjectIDs []int64    `json:"project_ids"`
+	Permission string     `json:"permission" binding:"required,oneof=read write"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// UpdateAPIKeyRequest represents the request payload for updating an API key
+type UpdateAPIKeyRequest struct {
+	Name       *string    `json:"name" binding:"omitempty,max=100"`
+	ProjectIDs []int64    `json:"project_ids"`
+	Permission *string    `json:"permission" binding:"omitempty,oneof=read write"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// APIKeyQuery represents query parameters for listing API keys
+type APIKeyQuery struct {
+	UserID *int `form:"user_id"`
+}
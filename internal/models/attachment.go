@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// TaskAttachment is a file attached to a task. ContentType is sniffed from
+// the content; SHA256 identifies the stored blob.
+type TaskAttachment struct {
+	ID          int       `json:"id" db:"id"`
+	TaskID      int       `json:"task_id" db:"task_id"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	SHA256      string    `json:"sha256" db:"blob_hash"`
+	UploadedBy  *int      `json:"uploaded_by" db:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// TaskComment represents a comment on a task. Replies point at the comment
+// they answer through ParentID; deleted comments keep their place in the
+// thread with an empty body.
+type TaskComment struct {
+	ID             int           `json:"id" db:"id"`
+	TaskID         int           `json:"task_id" db:"task_id"`
+	ParentID       *int          `json:"parent_id" db:"parent_id"`
+	AuthorID       *int          `json:"author_id" db:"author_id"`
+	AuthorUsername string        `json:"author_username" db:"author_username"`
+	Body           string        `json:"body" db:"body"`
+	Deleted        bool          `json:"deleted" db:"deleted"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at" db:"updated_at"`
+	EditedAt       *time.Time    `json:"edited_at" db:"edited_at"`
+	Replies        []TaskComment `json:"replies,omitempty"`
+}
+
+// TaskCommentEdit records the body a comment had before an edit
+type TaskCommentEdit struct {
+	ID           int       `json:"id" db:"id"`
+	CommentID    int       `json:"comment_id" db:"comment_id"`
+	EditorID     *int      `json:"editor_id" db:"editor_id"`
+	PreviousBody string    `json:"previous_body" db:"previous_body"`
+	EditedAt     time.Time `json:"edited_at" db:"edited_at"`
+}
+
+// CreateTaskCommentRequest represents the request payload for commenting on a task
+type CreateTaskCommentRequest struct {
+	Body     string `json:"body" binding:"required,max=10000"`
+	ParentID *int   `json:"parent_id"`
+}
+
+// UpdateTaskCommentRequest represents the request payload for editing a comment
+type UpdateTaskCommentRequest struct {
+	Body string `json:"body" binding:"required,max=10000"`
+}
+
+// TaskCommentQuery represents query parameters for listing a task's comments
+type TaskCommentQuery struct {
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+// TaskCommentPage is one page of top-level comments, each with all of its replies
+type TaskCommentPage struct {
+	Data       []TaskComment `json:"data"`
+	NextCursor *string       `json:"next_cursor"`
+}
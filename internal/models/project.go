@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// ProjectStatus represents valid project statuses
+type ProjectStatus string
+
+const (
+	ProjectStatusActive    ProjectStatus = "active"
+	ProjectStatusOnHold    ProjectStatus = "on_hold"
+	ProjectStatusCompleted ProjectStatus = "completed"
+	ProjectStatusArchived  ProjectStatus = "archived"
+)
+
+// CreateProjectRequest represents the request payload for creating a project
+type CreateProjectRequest struct {
+	Name        string `json:"name" binding:"required,max=255"`
+	Description string `json:"description"`
+	OwnerID     *int   `json:"owner_id"`
+	Status      string `json:"status" binding:"omitempty,oneof=active on_hold completed archived"`
+}
+
+// UpdateProjectRequest represents the request payload for updating a project
+type UpdateProjectRequest struct {
+	Name        *string `json:"name" binding:"omitempty,max=255"`
+	Description *string `json:"description"`
+	OwnerID     *int    `json:"owner_id"`
+	Status      *string `json:"status" binding:"omitempty,oneof=active on_hold completed archived"`
+}
+
+// ProjectQuery represents query parameters for filtering projects
+type ProjectQuery struct {
+	Status  []string `form:"status"`
+	OwnerID *int     `form:"owner_id"`
+	Limit   int      `form:"limit" binding:"omitempty,min=1,max=200"`
+	Offset  int      `form:"offset" binding:"min=0"`
+}
+
+// ProjectMember represents a user's membership in a project
+type ProjectMember struct {
+	ProjectID int       `json:"project_id" db:"project_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	FullName  string    `json:"full_name" db:"full_name"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AddProjectMemberRequest represents the request payload for adding a project member
+type AddProjectMemberRequest struct {
+	UserID int    `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"omitempty,max=50"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// TaskRecurrence makes a template task repeat on an iCalendar RRULE schedule.
+// Each occurrence is created as a copy of the template. NextAt is nil once
+// the schedule has ended.
+type TaskRecurrence struct {
+	ID             int         `json:"id" db:"id"`
+	TemplateTaskID int         `json:"template_task_id" db:"template_task_id"`
+	RRule          string      `json:"rrule" db:"rrule"`
+	StartsAt       time.Time   `json:"starts_at" db:"starts_at"`
+	Timezone       string      `json:"timezone" db:"timezone"`
+	NextAt         *time.Time  `json:"next_at" db:"next_at"`
+	LastError      *string     `json:"last_error" db:"last_error"`
+	CreatedBy      *int        `json:"created_by" db:"created_by"`
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" db:"updated_at"`
+	Upcoming       []time.Time `json:"upcoming"`
+}
+
+// SetTaskRecurrenceRequest represents the request payload for making a task
+// recur. StartsAt anchors the schedule and sets the time of day of each
+// occurrence in Timezone.
+type SetTaskRecurrenceRequest struct {
+	RRule    string    `json:"rrule" binding:"required,max=500"`
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	Timezone string    `json:"timezone"` // IANA name, defaults to UTC
+}
+
+// TaskOccurrence is a task created from a recurrence for one occurrence
+type TaskOccurrence struct {
+	OccurrenceAt time.Time `json:"occurrence_at" db:"occurrence_at"`
+	TaskID       *int      `json:"task_id" db:"task_id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
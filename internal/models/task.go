@@ -13,6 +13,7 @@ type Task struct {
 	Priority    int       `json:"priority" db:"priority"`
 	AssigneeID  *int      `json:"assignee_id" db:"assignee_id"`
 	ProjectID   int       `json:"project_id" db:"project_id" binding:"required"`
+	ParentID    *int      `json:"parent_id" db:"parent_id"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 	CompletedAt *time.Time `json:"completed_at" db:"completed_at"`
@@ -20,6 +21,16 @@ type Task struct {
 	EstimatedHours *float64 `json:"estimated_hours" db:"estimated_hours"`
 	ActualHours    *float64 `json:"actual_hours" db:"actual_hours"`
 	Tags        []string  `json:"tags"`
+
+	// Set only for full-text search results
+	SearchRank *float64        `json:"search_rank,omitempty"`
+	Highlights *TaskHighlights `json:"highlights,omitempty"`
+}
+
+// TaskHighlights holds search snippets with matches wrapped in <mark> tags
+type TaskHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
 }
 
 // TaskStatus represents valid task statuses
@@ -70,10 +81,11 @@ type TaskMetrics struct {
 type CreateTaskRequest struct {
 	Title          string     `json:"title" binding:"required"`
 	Description    string     `json:"description"`
-	Status         string     `json:"status" binding:"required"`
+	Status         string     `json:"status"` // defaults to the project workflow's initial status
 	Priority       int        `json:"priority"`
 	AssigneeID     *int       `json:"assignee_id"`
 	ProjectID      int        `json:"project_id" binding:"required"`
+	ParentID       *int       `json:"parent_id"` // must be a task in the same project
 	DueDate        *time.Time `json:"due_date"`
 	EstimatedHours *float64   `json:"estimated_hours"`
 	Tags           []string   `json:"tags"`
@@ -86,14 +98,22 @@ type UpdateTaskRequest struct {
 	Status         *string    `json:"status"`
 	Priority       *int       `json:"priority"`
 	AssigneeID     *int       `json:"assignee_id"`
+	ParentID       *int       `json:"parent_id"` // 0 makes the task top-level
 	DueDate        *time.Time `json:"due_date"`
 	EstimatedHours *float64   `json:"estimated_hours"`
-	ActualHours    *float64   `json:"actual_hours"`
 	Tags           []string   `json:"tags"`
+
+	// Deprecated: actual hours are the sum of the task's work logs and can no
+	// longer be set directly. Requests that set it are rejected.
+	ActualHours *float64 `json:"actual_hours"`
+
+	// Allows moving to in_progress or done while blockers are still open
+	OverrideBlockers bool `json:"override_blockers"`
 }
 
 // TaskQuery represents query parameters for filtering tasks
 type TaskQuery struct {
+	Q          string    `form:"q"`
 	Status     []string  `form:"status"`
 	AssigneeID *int      `form:"assignee_id"`
 	ProjectID  *int      `form:"project_id"`
@@ -101,16 +121,35 @@ type TaskQuery struct {
 	FromDate   *time.Time `form:"from_date" time_format:"2006-01-02"`
 	ToDate     *time.Time `form:"to_date" time_format:"2006-01-02"`
 	Tags       []string  `form:"tags"`
+	Blocked    *bool     `form:"blocked"`
 	Limit      int       `form:"limit"`
-	Offset     int       `form:"offset"`
+	Cursor     string    `form:"cursor"`
+	IncludeTotal bool    `form:"include_total"`
 	SortBy     string    `form:"sort_by"`
 	SortOrder  string    `form:"sort_order"`
 }
 
+// TaskExportQuery represents query parameters for exporting tasks. The
+// TaskQuery filters and sort apply; its pagination parameters are ignored.
+type TaskExportQuery struct {
+	TaskQuery
+	Format   string   `form:"format"`   // csv (default) or ndjson
+	Columns  []string `form:"columns"`  // comma-separated or repeated; defaults to every column
+	Timezone string   `form:"timezone"` // IANA name for timestamps, defaults to UTC
+}
+
+// TaskPage is one page of a task listing
+type TaskPage struct {
+	Data       []Task  `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+	TotalCount *int    `json:"total_count,omitempty"`
+}
+
 // MetricsQuery represents query parameters for metrics
 type MetricsQuery struct {
 	FromDate  time.Time `form:"from_date" binding:"required" time_format:"2006-01-02"`
 	ToDate    time.Time `form:"to_date" binding:"required" time_format:"2006-01-02"`
 	ProjectID *int      `form:"project_id"`
 	Interval  string    `form:"interval"` // hour, day, week, month
+	LeafOnly  bool      `form:"leaf_only"`
 }
\ No newline at end of file
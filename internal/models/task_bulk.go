@@ -0,0 +1,55 @@
+package models
+
+import "encoding/json"
+
+// Bulk operation types
+const (
+	BulkOpCreate = "create"
+	BulkOpUpdate = "update"
+	BulkOpDelete = "delete"
+)
+
+// Bulk modes
+const (
+	// BulkModeAtomic applies all operations or none of them
+	BulkModeAtomic = "atomic"
+	// BulkModeBestEffort applies every operation that succeeds
+	BulkModeBestEffort = "best_effort"
+)
+
+// BulkTaskOperation is a single operation of a bulk request. Data holds a
+// CreateTaskRequest for creates and an UpdateTaskRequest for updates; ID is
+// required for updates and deletes.
+type BulkTaskOperation struct {
+	Op   string          `json:"op" binding:"required,oneof=create update delete"`
+	ID   int             `json:"id"`
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// BulkTaskRequest represents the request payload for bulk task operations
+type BulkTaskRequest struct {
+	Mode       string              `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []BulkTaskOperation `json:"operations" binding:"required,min=1,max=500,dive"`
+}
+
+// BulkTaskResult is the outcome of one operation, in request order. Status is
+// the HTTP status the operation would have had as a single request.
+type BulkTaskResult struct {
+	Index           int      `json:"index"`
+	Op              string   `json:"op"`
+	ID              *int     `json:"id,omitempty"`
+	Status          int      `json:"status"`
+	Task            *Task    `json:"task,omitempty"`
+	Error           string   `json:"error,omitempty"`
+	AllowedStatuses []string `json:"allowed_statuses,omitempty"`
+	BlockedBy       []int    `json:"blocked_by,omitempty"`
+}
+
+// BulkTaskResponse summarizes a bulk request
+type BulkTaskResponse struct {
+	Mode      string           `json:"mode"`
+	Committed bool             `json:"committed"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkTaskResult `json:"results"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// TaskDependency records that TaskID is blocked by BlockedByID
+type TaskDependency struct {
+	TaskID      int       `json:"task_id" db:"task_id"`
+	BlockedByID int       `json:"blocked_by_id" db:"blocked_by_id"`
+	CreatedBy   *int      `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// DependencyTask summarizes the task on the other end of a dependency. Open
+// is true until the task is done or cancelled.
+type DependencyTask struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	ProjectID int       `json:"project_id"`
+	Open      bool      `json:"open"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaskDependencies lists the tasks blocking a task and the tasks it blocks
+type TaskDependencies struct {
+	TaskID    int              `json:"task_id"`
+	BlockedBy []DependencyTask `json:"blocked_by"`
+	Blocks    []DependencyTask `json:"blocks"`
+}
+
+// AddTaskDependencyRequest represents the request payload for adding a blocker to a task
+type AddTaskDependencyRequest struct {
+	BlockedByID int `json:"blocked_by_id" binding:"required"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Task event types recorded in the task_events hypertable
+const (
+	TaskEventCreated = "created"
+	TaskEventUpdated = "updated"
+	TaskEventDeleted = "deleted"
+)
+
+// FieldChange holds the old and new value of a changed task field
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// TaskEvent represents a recorded change to a task
+type TaskEvent struct {
+	ID         int64                  `json:"id" db:"id"`
+	OccurredAt time.Time              `json:"occurred_at" db:"occurred_at"`
+	TaskID     int                    `json:"task_id" db:"task_id"`
+	ProjectID  int                    `json:"project_id" db:"project_id"`
+	ActorID    *int                   `json:"actor_id" db:"actor_id"`
+	EventType  string                 `json:"event_type" db:"event_type"`
+	Changes    map[string]FieldChange `json:"changes" db:"changes"`
+}
+
+// TaskHistoryQuery represents query parameters for a task's change history
+type TaskHistoryQuery struct {
+	From  *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To    *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit int        `form:"limit"`
+}
+
+// TaskStreamQuery represents query parameters for the task change stream
+type TaskStreamQuery struct {
+	ProjectIDs  []int  `form:"project_id"`
+	LastEventID *int64 `form:"last_event_id"` // for clients that cannot send the Last-Event-ID header
+}
+
+// TaskStreamMessage is a message on the WebSocket task change stream.
+// Heartbeats only carry the event "ping".
+type TaskStreamMessage struct {
+	ID    int64      `json:"id,omitempty"`
+	Event string     `json:"event"`
+	Data  *TaskEvent `json:"data,omitempty"`
+}
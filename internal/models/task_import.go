@@ -0,0 +1,41 @@
+package models
+
+// Import formats
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// TaskImportQuery represents query parameters for importing tasks. Mapping
+// entries have the form "source:field" and rename a file column (or NDJSON
+// key) to a task field.
+type TaskImportQuery struct {
+	Format      string   `form:"format" binding:"omitempty,oneof=csv ndjson"`
+	DryRun      bool     `form:"dry_run"`
+	SkipInvalid bool     `form:"skip_invalid"`
+	ProjectID   *int     `form:"project_id"`
+	Mapping     []string `form:"map"`
+	Timezone    string   `form:"timezone"`
+}
+
+// TaskImportError is a problem with one row of an import. Line is the line of
+// the file the row starts on; Field is empty for problems with the whole row.
+type TaskImportError struct {
+	Line  int    `json:"line"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// TaskImportReport summarizes an import. Rows that failed validation are
+// Invalid; valid rows that could not be inserted are Failed.
+type TaskImportReport struct {
+	Format         string            `json:"format"`
+	DryRun         bool              `json:"dry_run"`
+	Rows           int               `json:"rows"`
+	Valid          int               `json:"valid"`
+	Invalid        int               `json:"invalid"`
+	Inserted       int               `json:"inserted"`
+	Failed         int               `json:"failed"`
+	IgnoredColumns []string          `json:"ignored_columns,omitempty"`
+	Errors         []TaskImportError `json:"errors"`
+}
@@ -0,0 +1,34 @@
+package models
+
+// How DELETE /tasks/:id treats the subtasks of the deleted task
+const (
+	// DeleteChildrenReparent moves the children up to the deleted task's parent
+	DeleteChildrenReparent = "reparent"
+	// DeleteChildrenCascade deletes the whole subtree
+	DeleteChildrenCascade = "cascade"
+)
+
+// TaskRollup holds values computed over a task and all of its subtasks.
+// Hours add up the task's own hours and those of every descendant.
+// PercentComplete is the share of leaf tasks that are completed; cancelled leaves
+// are not counted.
+type TaskRollup struct {
+	EstimatedHours  float64 `json:"estimated_hours"`
+	ActualHours     float64 `json:"actual_hours"`
+	PercentComplete float64 `json:"percent_complete"`
+	Subtasks        int     `json:"subtasks"`
+	LeafTasks       int     `json:"leaf_tasks"`
+	DoneLeafTasks   int     `json:"done_leaf_tasks"`
+}
+
+// TaskNode is a task with its rollup and, in tree responses, its subtasks
+type TaskNode struct {
+	Task
+	Rollup   TaskRollup `json:"rollup"`
+	Children []TaskNode `json:"children,omitempty"`
+}
+
+// DeleteTaskQuery represents query parameters for deleting a task
+type DeleteTaskQuery struct {
+	Children string `form:"children" binding:"omitempty,oneof=reparent cascade"`
+}
@@ -0,0 +1,55 @@
+package models
+
+// UserRole represents valid user roles
+type UserRole string
+
+const (
+	UserRoleUser  UserRole = "user"
+	UserRoleAdmin UserRole = "admin"
+)
+
+// UserSummary is the public view of a user returned by the user directory
+type UserSummary struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"full_name"`
+}
+
+// CreateUserRequest represents the request payload for creating a user as an admin
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	FullName string `json:"full_name" binding:"max=255"`
+	Role     string `json:"role" binding:"omitempty,max=50"`
+}
+
+// UpdateUserRequest represents the request payload for updating a user as an admin
+type UpdateUserRequest struct {
+	Email    *string `json:"email" binding:"omitempty,email,max=255"`
+	Password *string `json:"password" binding:"omitempty,min=8,max=72"`
+	FullName *string `json:"full_name" binding:"omitempty,max=255"`
+	Role     *string `json:"role" binding:"omitempty,max=50"`
+}
+
+// RegisterRequest represents the request payload for self-registration
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	FullName string `json:"full_name" binding:"max=255"`
+}
+
+// UpdateProfileRequest represents the request payload for updating one's own profile
+type UpdateProfileRequest struct {
+	Email    *string `json:"email" binding:"omitempty,email,max=255"`
+	FullName *string `json:"full_name" binding:"omitempty,max=255"`
+}
+
+// UserQuery represents query parameters for searching users
+type UserQuery struct {
+	Q      string `form:"q"`
+	Role   string `form:"role"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
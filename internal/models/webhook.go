@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types. A task moving to one of its workflow's completed
+// statuses is reported as task.completed to webhooks subscribed to it, and as
+// task.updated otherwise.
+const (
+	WebhookEventTaskCreated   = "task.created"
+	WebhookEventTaskUpdated   = "task.updated"
+	WebhookEventTaskCompleted = "task.completed"
+	WebhookEventTaskDeleted   = "task.deleted"
+)
+
+// WebhookEventTypes lists the event types a webhook can subscribe to
+var WebhookEventTypes = []string{
+	WebhookEventTaskCreated,
+	WebhookEventTaskUpdated,
+	WebhookEventTaskCompleted,
+	WebhookEventTaskDeleted,
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription that POSTs task events to a URL. An empty
+// ProjectIDs matches every project. Secret is only returned when the webhook
+// is created.
+type Webhook struct {
+	ID                  int        `json:"id" db:"id"`
+	OwnerID             *int       `json:"owner_id" db:"owner_id"`
+	URL                 string     `json:"url" db:"url"`
+	Secret              string     `json:"secret,omitempty" db:"secret"`
+	EventTypes          []string   `json:"event_types" db:"event_types"`
+	ProjectIDs          []int64    `json:"project_ids" db:"project_ids"`
+	Active              bool       `json:"active" db:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures" db:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at" db:"disabled_at"`
+	DisabledReason      *string    `json:"disabled_reason" db:"disabled_reason"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CreateWebhookRequest represents the request payload for creating a webhook
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url,max=2000"`
+	EventTypes []string `json:"event_types" binding:"required,min=1"`
+	ProjectIDs []int64  `json:"project_ids"` // empty subscribes to all projects (admins only)
+}
+
+// UpdateWebhookRequest represents the request payload for updating a webhook.
+// Setting active re-enables a webhook that was disabled after failing.
+type UpdateWebhookRequest struct {
+	URL        *string  `json:"url" binding:"omitempty,url,max=2000"`
+	EventTypes []string `json:"event_types" binding:"omitempty,min=1"`
+	ProjectIDs []int64  `json:"project_ids"`
+	Active     *bool    `json:"active"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook
+type WebhookDelivery struct {
+	ID             int64           `json:"id" db:"id"`
+	WebhookID      int             `json:"webhook_id" db:"webhook_id"`
+	EventID        int64           `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at" db:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at" db:"last_attempt_at"`
+	ResponseStatus *int            `json:"response_status" db:"response_status"`
+	LastError      *string         `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+// WebhookDeliveryQuery represents query parameters for a webhook's delivery log
+type WebhookDeliveryQuery struct {
+	Status string `form:"status"`
+	Limit  int    `form:"limit"`
+}
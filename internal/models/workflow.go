@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// Workflow describes the statuses a project's tasks can be in and the status
+// changes allowed between them. Tasks entering one of the completed statuses
+// are stamped with completed_at and count as completed. Projects without a
+// stored workflow use DefaultWorkflow.
+type Workflow struct {
+	ProjectID         int                 `json:"project_id"`
+	InitialStatus     string              `json:"initial_status"`
+	Statuses          []string            `json:"statuses"`
+	CompletedStatuses []string            `json:"completed_statuses"`
+	Transitions       map[string][]string `json:"transitions"`
+	IsDefault         bool                `json:"is_default"`
+	UpdatedAt         *time.Time          `json:"updated_at,omitempty"`
+}
+
+// DefaultWorkflow returns the workflow used by projects that have not configured one
+func DefaultWorkflow(projectID int) Workflow {
+	return Workflow{
+		ProjectID:     projectID,
+		InitialStatus: string(TaskStatusTodo),
+		Statuses: []string{
+			string(TaskStatusTodo), string(TaskStatusInProgress), string(TaskStatusReview),
+			string(TaskStatusDone), string(TaskStatusCancelled),
+		},
+		CompletedStatuses: []string{string(TaskStatusDone)},
+		Transitions: map[string][]string{
+			string(TaskStatusTodo):       {string(TaskStatusInProgress), string(TaskStatusDone), string(TaskStatusCancelled)},
+			string(TaskStatusInProgress): {string(TaskStatusTodo), string(TaskStatusReview), string(TaskStatusDone), string(TaskStatusCancelled)},
+			string(TaskStatusReview):     {string(TaskStatusInProgress), string(TaskStatusDone), string(TaskStatusCancelled)},
+			string(TaskStatusDone):       {string(TaskStatusTodo), string(TaskStatusInProgress)},
+			string(TaskStatusCancelled):  {string(TaskStatusTodo)},
+		},
+		IsDefault: true,
+	}
+}
+
+// HasStatus reports whether status is part of the workflow
+func (w Workflow) HasStatus(status string) bool {
+	for _, s := range w.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCompleted reports whether tasks in status count as completed
+func (w Workflow) IsCompleted(status string) bool {
+	for _, s := range w.CompletedStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// NextStatuses returns the statuses a task in status from may move to
+func (w Workflow) NextStatuses(from string) []string {
+	next := w.Transitions[from]
+	if next == nil {
+		return []string{}
+	}
+	return next
+}
+
+// CanTransition reports whether a task may move from one status to another.
+// Keeping the current status is always allowed.
+func (w Workflow) CanTransition(from, to string) bool {
+	if from == to {
+		return w.HasStatus(to)
+	}
+	for _, s := range w.Transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateWorkflowRequest represents the request payload for configuring a
+// project's workflow. CompletedStatuses defaults to done when the workflow
+// has it.
+type UpdateWorkflowRequest struct {
+	InitialStatus     string              `json:"initial_status" binding:"required"`
+	Statuses          []string            `json:"statuses" binding:"required,min=1,dive,required,max=50"`
+	CompletedStatuses []string            `json:"completed_statuses"`
+	Transitions       map[string][]string `json:"transitions" binding:"required"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// WorkLog is a time entry recorded against a task. DurationSeconds is nil
+// while the entry is a running timer.
+type WorkLog struct {
+	ID              int64     `json:"id" db:"id"`
+	TaskID          int       `json:"task_id" db:"task_id"`
+	UserID          *int      `json:"user_id" db:"user_id"`
+	StartedAt       time.Time `json:"started_at" db:"started_at"`
+	DurationSeconds *int      `json:"duration_seconds" db:"duration_seconds"`
+	Running         bool      `json:"running" db:"running"`
+	Note            string    `json:"note" db:"note"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CreateWorkLogRequest represents the request payload for logging time on a task
+type CreateWorkLogRequest struct {
+	StartedAt       time.Time `json:"started_at" binding:"required"`
+	DurationSeconds int       `json:"duration_seconds" binding:"required,min=1,max=86400"`
+	Note            string    `json:"note" binding:"max=2000"`
+}
+
+// UpdateWorkLogRequest represents the request payload for updating a time
+// entry. Setting a duration on a running timer stops it.
+type UpdateWorkLogRequest struct {
+	StartedAt       *time.Time `json:"started_at"`
+	DurationSeconds *int       `json:"duration_seconds" binding:"omitempty,min=1,max=86400"`
+	Note            *string    `json:"note" binding:"omitempty,max=2000"`
+}
+
+// StartTimerRequest represents the request payload for starting a timer on a task
+type StartTimerRequest struct {
+	Note string `json:"note" binding:"max=2000"`
+}
+
+// WorkLogQuery represents query parameters for listing a task's time entries
+type WorkLogQuery struct {
+	From   *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	UserID *int       `form:"user_id"`
+	Limit  int        `form:"limit"`
+}
+
+// TimesheetQuery represents query parameters for a user's timesheet
+type TimesheetQuery struct {
+	FromDate time.Time `form:"from_date" binding:"required" time_format:"2006-01-02"`
+	ToDate   time.Time `form:"to_date" binding:"required" time_format:"2006-01-02"`
+	UserID   *int      `form:"user_id"`
+}
+
+// TimesheetEntry is the time a user logged on one task during one day
+type TimesheetEntry struct {
+	TaskID    int    `json:"task_id"`
+	TaskTitle string `json:"task_title"`
+	ProjectID int    `json:"project_id"`
+	Seconds   int64  `json:"seconds"`
+}
+
+// TimesheetDay groups a user's logged time by task for one day
+type TimesheetDay struct {
+	Date         string           `json:"date"`
+	TotalSeconds int64            `json:"total_seconds"`
+	Entries      []TimesheetEntry `json:"entries"`
+}
+
+// Timesheet is the time a user logged over a date range, by day. Running
+// timers are not included.
+type Timesheet struct {
+	UserID       int            `json:"user_id"`
+	FromDate     string         `json:"from_date"`
+	ToDate       string         `json:"to_date"`
+	TotalSeconds int64          `json:"total_seconds"`
+	Days         []TimesheetDay `json:"days"`
+}
@@ -0,0 +1,398 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the RRULE FREQ part
+type Frequency int
+
+const (
+	Daily Frequency = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+// maxPeriods bounds the search for the next occurrence, so rules that can
+// never match (such as the 30th of February) end instead of looping forever
+const maxPeriods = 10000
+
+var frequencies = map[string]Frequency{
+	"DAILY":   Daily,
+	"WEEKLY":  Weekly,
+	"MONTHLY": Monthly,
+	"YEARLY":  Yearly,
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// WeekdayNum is a BYDAY entry. N selects the Nth such weekday of the month,
+// counting from the end when negative; 0 selects every one.
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule is a parsed iCalendar (RFC 5545) recurrence rule anchored at a start
+// time. The supported parts are FREQ (DAILY, WEEKLY, MONTHLY or YEARLY),
+// INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH; occurrences happen at
+// the start's time of day in the start's location.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+
+	start time.Time
+}
+
+// Parse parses an RRULE value such as "FREQ=WEEKLY;BYDAY=MO,TH" anchored at
+// start. A leading "RRULE:" is accepted.
+func Parse(text string, start time.Time) (*Rule, error) {
+	text = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(text)), "RRULE:")
+	if text == "" {
+		return nil, errors.New("rrule is empty")
+	}
+
+	rule := &Rule{Interval: 1, start: start.Truncate(time.Second)}
+	hasFreq := false
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(text, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rrule part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate rrule part %s", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.Freq, hasFreq = frequencies[value]
+			if !hasFreq {
+				return nil, fmt.Errorf("unsupported FREQ %s", value)
+			}
+		case "INTERVAL":
+			rule.Interval, err = parseNumber(value, 1, 1000)
+		case "COUNT":
+			rule.Count, err = parseNumber(value, 1, 100000)
+		case "UNTIL":
+			rule.Until, err = parseUntil(value, start.Location())
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseNumbers(value, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseNumbers(value, 1, 12)
+			for _, m := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(m))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rrule part %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+
+	if !hasFreq {
+		return nil, errors.New("rrule must include FREQ")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, errors.New("rrule must not include both COUNT and UNTIL")
+	}
+	for _, day := range rule.ByDay {
+		if day.N == 0 {
+			continue
+		}
+		if rule.Freq == Daily || rule.Freq == Weekly {
+			return nil, errors.New("numbered BYDAY values require FREQ=MONTHLY or FREQ=YEARLY")
+		}
+		if rule.Freq == Yearly && len(rule.ByMonth) == 0 {
+			return nil, errors.New("numbered BYDAY values with FREQ=YEARLY require BYMONTH")
+		}
+		if day.N < -5 || day.N > 5 {
+			return nil, errors.New("invalid BYDAY: week number must be between -5 and 5")
+		}
+	}
+	if rule.Freq == Weekly && len(rule.ByMonthDay) > 0 {
+		return nil, errors.New("BYMONTHDAY is not allowed with FREQ=WEEKLY")
+	}
+
+	return rule, nil
+}
+
+// Start returns the time the rule is anchored at
+func (r *Rule) Start() time.Time {
+	return r.start
+}
+
+// Next returns the first occurrence strictly after after. It returns false
+// when the rule has no further occurrences.
+func (r *Rule) Next(after time.Time) (time.Time, bool) {
+	count := 0
+	first := r.firstPeriod(after)
+	for k := first; k < first+maxPeriods; k++ {
+		for _, occurrence := range r.period(k) {
+			if occurrence.Before(r.start) {
+				continue
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return time.Time{}, false
+			}
+			if !r.Until.IsZero() && occurrence.After(r.Until) {
+				return time.Time{}, false
+			}
+			if occurrence.After(after) {
+				return occurrence, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Upcoming returns up to n occurrences strictly after after
+func (r *Rule) Upcoming(after time.Time, n int) []time.Time {
+	occurrences := []time.Time{}
+	for len(occurrences) < n {
+		next, ok := r.Next(after)
+		if !ok {
+			break
+		}
+		occurrences = append(occurrences, next)
+		after = next
+	}
+	return occurrences
+}
+
+// firstPeriod returns the index of a period no later than the one holding the
+// first occurrence after after. Periods before it can only be skipped when
+// COUNT does not need them counted.
+func (r *Rule) firstPeriod(after time.Time) int {
+	if r.Count > 0 || !after.After(r.start) {
+		return 0
+	}
+
+	after = after.In(r.start.Location())
+	var periods int
+	switch r.Freq {
+	case Daily:
+		periods = int(after.Sub(r.start).Hours()/24) - 1
+	case Weekly:
+		periods = int(after.Sub(r.start).Hours()/24/7) - 1
+	case Monthly:
+		periods = (after.Year()-r.start.Year())*12 + int(after.Month()-r.start.Month()) - 1
+	case Yearly:
+		periods = after.Year() - r.start.Year() - 1
+	}
+	if periods < 0 {
+		return 0
+	}
+	return periods / r.Interval
+}
+
+// period returns the candidate occurrences of the kth period in order
+func (r *Rule) period(k int) []time.Time {
+	start := r.start
+	year, month, day := start.Date()
+	step := k * r.Interval
+
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		days = []time.Time{r.at(year, month, day+step)}
+	case Weekly:
+		monday := day - (int(start.Weekday())+6)%7 + 7*step
+		if len(r.ByDay) == 0 {
+			days = []time.Time{r.at(year, month, day+7*step)}
+		}
+		for i := 0; i < 7 && len(r.ByDay) > 0; i++ {
+			days = append(days, r.at(year, month, monday+i))
+		}
+	case Monthly:
+		days = r.monthDays(year, month+time.Month(step))
+	case Yearly:
+		// Without BYMONTH, BYDAY and BYMONTHDAY pick days across the whole
+		// year; otherwise the rule repeats on the start's date
+		months := r.ByMonth
+		if len(months) == 0 && len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			months = []time.Month{month}
+		}
+		if len(months) == 0 {
+			for m := time.January; m <= time.December; m++ {
+				months = append(months, m)
+			}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(year+step, m)...)
+		}
+	}
+
+	occurrences := days[:0]
+	for _, t := range days {
+		if r.matches(t) {
+			occurrences = append(occurrences, t)
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Before(occurrences[j]) })
+	return occurrences
+}
+
+// monthDays returns the candidate days of one month. Without BYDAY or
+// BYMONTHDAY that is the start's day of the month, if the month has it.
+func (r *Rule) monthDays(year int, month time.Month) []time.Time {
+	first := r.at(year, month, 1)
+	year, month = first.Year(), first.Month()
+	length := r.at(year, month+1, 0).Day()
+
+	if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+		if r.start.Day() > length {
+			return nil
+		}
+		return []time.Time{r.at(year, month, r.start.Day())}
+	}
+
+	var days []time.Time
+	for d := 1; d <= length; d++ {
+		days = append(days, r.at(year, month, d))
+	}
+	return days
+}
+
+// matches reports whether t satisfies the rule's BY* filters
+func (r *Rule) matches(t time.Time) bool {
+	if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, t.Month()) {
+		return false
+	}
+
+	length := r.at(t.Year(), t.Month()+1, 0).Day()
+	if len(r.ByMonthDay) > 0 {
+		found := false
+		for _, d := range r.ByMonthDay {
+			if d == t.Day() || d < 0 && length+d+1 == t.Day() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.ByDay) > 0 {
+		found := false
+		for _, d := range r.ByDay {
+			if d.Weekday != t.Weekday() {
+				continue
+			}
+			if d.N == 0 ||
+				d.N > 0 && (t.Day()-1)/7+1 == d.N ||
+				d.N < 0 && (length-t.Day())/7+1 == -d.N {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// at returns the given day at the start's time of day and location
+func (r *Rule) at(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, r.start.Hour(), r.start.Minute(), r.start.Second(), 0, r.start.Location())
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, m := range months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNumber(value string, min, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s is not a number between %d and %d", value, min, max)
+	}
+	return n, nil
+}
+
+func parseNumbers(value string, min, max int) ([]int, error) {
+	var numbers []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := parseNumber(part, min, max)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errors.New("0 is not allowed")
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, part := range strings.Split(value, ",") {
+		if len(part) < 2 {
+			return nil, fmt.Errorf("%q is not a weekday", part)
+		}
+		weekday, ok := weekdays[part[len(part)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("%q is not a weekday", part)
+		}
+		day := WeekdayNum{Weekday: weekday}
+		if prefix := part[:len(part)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("%q is not a weekday", part)
+			}
+			day.N = n
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// parseUntil parses an UNTIL value. A date without a time includes that
+// whole day in loc.
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%s is not a date or UTC date-time", value)
+}
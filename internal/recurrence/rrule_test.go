@@ -0,0 +1,176 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 9, 0, 0, 0, time.UTC)
+}
+
+func TestRuleUpcoming(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+		start time.Time
+		after time.Time
+		n     int
+		want  []time.Time
+	}{
+		{
+			name:  "monthly on the 31st skips shorter months",
+			rrule: "FREQ=MONTHLY",
+			start: day(2025, time.January, 31),
+			after: day(2025, time.January, 31),
+			n:     3,
+			want:  []time.Time{day(2025, time.March, 31), day(2025, time.May, 31), day(2025, time.July, 31)},
+		},
+		{
+			name:  "yearly on February 29th waits for leap years",
+			rrule: "FREQ=YEARLY",
+			start: day(2024, time.February, 29),
+			after: day(2024, time.February, 29),
+			n:     2,
+			want:  []time.Time{day(2028, time.February, 29), day(2032, time.February, 29)},
+		},
+		{
+			name:  "last day of the month",
+			rrule: "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start: day(2024, time.January, 15),
+			after: day(2024, time.January, 15),
+			n:     3,
+			want:  []time.Time{day(2024, time.January, 31), day(2024, time.February, 29), day(2024, time.March, 31)},
+		},
+		{
+			name:  "last Friday of the month",
+			rrule: "FREQ=MONTHLY;BYDAY=-1FR",
+			start: day(2025, time.January, 1),
+			after: day(2025, time.January, 1),
+			n:     3,
+			want:  []time.Time{day(2025, time.January, 31), day(2025, time.February, 28), day(2025, time.March, 28)},
+		},
+		{
+			name:  "every other week on Monday and Friday",
+			rrule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			start: day(2025, time.January, 6),
+			after: day(2025, time.January, 5),
+			n:     4,
+			want:  []time.Time{day(2025, time.January, 6), day(2025, time.January, 10), day(2025, time.January, 20), day(2025, time.January, 24)},
+		},
+		{
+			name:  "every other month on the first Monday",
+			rrule: "FREQ=MONTHLY;INTERVAL=2;BYDAY=1MO",
+			start: day(2025, time.January, 1),
+			after: day(2025, time.January, 1),
+			n:     3,
+			want:  []time.Time{day(2025, time.January, 6), day(2025, time.March, 3), day(2025, time.May, 5)},
+		},
+		{
+			name:  "yearly on Mondays continues past the start month",
+			rrule: "FREQ=YEARLY;BYDAY=MO",
+			start: day(2025, time.January, 6),
+			after: day(2025, time.January, 26),
+			n:     2,
+			want:  []time.Time{day(2025, time.January, 27), day(2025, time.February, 3)},
+		},
+		{
+			name:  "yearly on a month day repeats every month",
+			rrule: "FREQ=YEARLY;BYMONTHDAY=15",
+			start: day(2025, time.January, 15),
+			after: day(2025, time.January, 15),
+			n:     2,
+			want:  []time.Time{day(2025, time.February, 15), day(2025, time.March, 15)},
+		},
+		{
+			name:  "yearly on Mondays of BYMONTH",
+			rrule: "FREQ=YEARLY;BYMONTH=3;BYDAY=MO",
+			start: day(2025, time.January, 1),
+			after: day(2025, time.March, 24),
+			n:     2,
+			want:  []time.Time{day(2025, time.March, 31), day(2026, time.March, 2)},
+		},
+		{
+			name:  "COUNT includes the start",
+			rrule: "FREQ=DAILY;COUNT=3",
+			start: day(2025, time.January, 1),
+			after: day(2024, time.December, 31),
+			n:     5,
+			want:  []time.Time{day(2025, time.January, 1), day(2025, time.January, 2), day(2025, time.January, 3)},
+		},
+		{
+			name:  "COUNT is spent by occurrences before after",
+			rrule: "FREQ=WEEKLY;COUNT=3",
+			start: day(2025, time.January, 1),
+			after: day(2025, time.January, 10),
+			n:     5,
+			want:  []time.Time{day(2025, time.January, 15)},
+		},
+		{
+			name:  "UNTIL date includes that day",
+			rrule: "FREQ=WEEKLY;UNTIL=20250120",
+			start: day(2025, time.January, 6),
+			after: day(2025, time.January, 6),
+			n:     5,
+			want:  []time.Time{day(2025, time.January, 13), day(2025, time.January, 20)},
+		},
+		{
+			name:  "UNTIL date-time is inclusive",
+			rrule: "FREQ=DAILY;UNTIL=20250103T090000Z",
+			start: day(2025, time.January, 1),
+			after: day(2025, time.January, 1),
+			n:     5,
+			want:  []time.Time{day(2025, time.January, 2), day(2025, time.January, 3)},
+		},
+		{
+			name:  "impossible date ends",
+			rrule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30",
+			start: day(2025, time.January, 1),
+			after: day(2025, time.January, 1),
+			n:     1,
+			want:  []time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rrule, tt.start)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.rrule, err)
+			}
+			got := rule.Upcoming(tt.after, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Upcoming = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Fatalf("Upcoming = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		rrule string
+	}{
+		{"missing FREQ", "INTERVAL=2"},
+		{"unsupported FREQ", "FREQ=HOURLY"},
+		{"COUNT and UNTIL", "FREQ=DAILY;COUNT=2;UNTIL=20250101"},
+		{"numbered BYDAY with WEEKLY", "FREQ=WEEKLY;BYDAY=1MO"},
+		{"numbered BYDAY with YEARLY and no BYMONTH", "FREQ=YEARLY;BYDAY=1MO"},
+		{"BYMONTHDAY with WEEKLY", "FREQ=WEEKLY;BYMONTHDAY=1"},
+		{"zero BYMONTHDAY", "FREQ=MONTHLY;BYMONTHDAY=0"},
+		{"duplicate part", "FREQ=DAILY;FREQ=WEEKLY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.rrule, day(2025, time.January, 1)); err == nil {
+				t.Fatalf("Parse(%q) succeeded, want an error", tt.rrule)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package recurrence
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"scalable-task-api/internal/config"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TaskCreator inserts a task within a transaction through the same path as
+// the API's task creation
+type TaskCreator interface {
+	CreateTaskTx(tx *sql.Tx, req models.CreateTaskRequest) (models.Task, error)
+}
+
+// Scheduler creates the tasks of recurring templates as their occurrences come
+// due. Each occurrence is created in one transaction that holds the
+// recurrence row, records the occurrence and advances next_at, so restarts
+// and concurrent replicas never create an occurrence twice. Occurrences that
+// passed while no scheduler was running are skipped rather than created late.
+type Scheduler struct {
+	db       *sql.DB
+	tasks    TaskCreator
+	interval time.Duration
+	lead     time.Duration
+}
+
+// NewScheduler creates a new recurrence scheduler
+func NewScheduler(db *sql.DB, tasks TaskCreator, cfg *config.RecurrenceConfig) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		tasks:    tasks,
+		interval: cfg.Interval,
+		lead:     cfg.Lead,
+	}
+}
+
+// Run creates due occurrences immediately and then once per interval until
+// ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Printf("Starting recurrence scheduler every %s", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Materialize(ctx); err != nil {
+			log.Printf("Recurrence scheduling failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Recurrence scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Materialize creates a task for every occurrence due within the lead time.
+// A recurrence that fails is skipped for the rest of the run and its error is
+// stored on it; it is retried on the next run.
+func (s *Scheduler) Materialize(ctx context.Context) error {
+	failed := []int64{}
+	for {
+		id, found, err := s.materializeNext(ctx, failed)
+		if !found {
+			return err
+		}
+		if err != nil {
+			log.Printf("Failed to create occurrence of recurrence %d: %v", id, err)
+			failed = append(failed, int64(id))
+			if _, err := s.db.ExecContext(ctx, `
+				UPDATE task_recurrences SET last_error = $2, updated_at = NOW() WHERE id = $1
+			`, id, err.Error()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// materializeNext creates the earliest due occurrence of any recurrence not
+// in skip and not held by another replica. It returns false when there is
+// nothing to do.
+func (s *Scheduler) materializeNext(ctx context.Context, skip []int64) (int, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, templateID   int
+		text, timezone   string
+		startsAt, nextAt time.Time
+		createdBy        *int
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, template_task_id, rrule, starts_at, timezone, next_at, created_by
+		FROM task_recurrences
+		WHERE next_at <= NOW() + make_interval(secs => $1) AND NOT (id = ANY($2))
+		ORDER BY next_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, s.lead.Seconds(), pq.Int64Array(skip)).Scan(&id, &templateID, &text, &startsAt, &timezone, &nextAt, &createdBy)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	// An occurrence more than one interval in the past was missed rather than
+	// just picked up by this run
+	cutoff := time.Now().Add(-s.interval)
+	missed := nextAt.Before(cutoff)
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return id, true, err
+	}
+	rule, err := Parse(text, startsAt.In(loc))
+	if err != nil {
+		return id, true, err
+	}
+
+	// Attribute the created task to whoever set up the recurrence
+	if createdBy != nil {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('app.actor_id', $1, TRUE)`, strconv.Itoa(*createdBy)); err != nil {
+			return id, true, err
+		}
+	}
+
+	after := nextAt
+	if missed {
+		log.Printf("Skipping occurrences of recurrence %d missed since %s", id, nextAt.Format(time.RFC3339))
+		after = cutoff
+	} else {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO task_occurrences (recurrence_id, occurrence_at) VALUES ($1, $2)
+			ON CONFLICT (recurrence_id, occurrence_at) DO NOTHING
+		`, id, nextAt)
+		if err != nil {
+			return id, true, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return id, true, err
+		} else if n > 0 {
+			if err := s.createOccurrence(tx, id, templateID, nextAt.In(loc)); err != nil {
+				return id, true, err
+			}
+		}
+	}
+
+	var next *time.Time
+	if t, ok := rule.Next(after); ok {
+		next = &t
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE task_recurrences SET next_at = $2, last_error = NULL, updated_at = NOW() WHERE id = $1
+	`, id, next); err != nil {
+		return id, true, err
+	}
+
+	return id, true, tx.Commit()
+}
+
+// createOccurrence copies the template task into a new task due at the
+// occurrence and links it to the occurrence
+func (s *Scheduler) createOccurrence(tx *sql.Tx, recurrenceID, templateID int, occurrenceAt time.Time) error {
+	var req models.CreateTaskRequest
+	err := tx.QueryRow(`
+		SELECT title, description, priority, assignee_id, project_id, parent_id, estimated_hours, tags
+		FROM tasks WHERE id = $1
+	`, templateID).Scan(
+		&req.Title, &req.Description, &req.Priority, &req.AssigneeID,
+		&req.ProjectID, &req.ParentID, &req.EstimatedHours, pq.Array(&req.Tags),
+	)
+	if err != nil {
+		return fmt.Errorf("load template task %d: %w", templateID, err)
+	}
+	req.DueDate = &occurrenceAt
+
+	task, err := s.tasks.CreateTaskTx(tx, req)
+	if err != nil {
+		return fmt.Errorf("create task: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE task_occurrences SET task_id = $3 WHERE recurrence_id = $1 AND occurrence_at = $2
+	`, recurrenceID, occurrenceAt, task.ID)
+	return err
+}
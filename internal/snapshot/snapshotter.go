@@ -0,0 +1,70 @@
+package snapshot
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"scalable-task-api/internal/config"
+	"time"
+)
+
+// Snapshotter periodically writes per-project task counts to the task_metrics
+// hypertable so the series survives later task edits and deletes.
+type Snapshotter struct {
+	db       *sql.DB
+	interval time.Duration
+}
+
+// NewSnapshotter creates a new snapshotter
+func NewSnapshotter(db *sql.DB, cfg *config.SnapshotConfig) *Snapshotter {
+	return &Snapshotter{
+		db:       db,
+		interval: cfg.Interval,
+	}
+}
+
+// Run takes a snapshot immediately and then once per interval until ctx is done
+func (s *Snapshotter) Run(ctx context.Context) {
+	log.Printf("Starting task metrics snapshotter every %s", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Snapshot(ctx); err != nil {
+			log.Printf("Task metrics snapshot failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Task metrics snapshotter stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snapshot writes one row per project for the current interval. Timestamps are
+// aligned to the interval, so replicas that run concurrently or a restart
+// within the same interval do not write duplicate rows.
+func (s *Snapshotter) Snapshot(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO task_metrics (
+			timestamp, project_id, total_tasks, completed_tasks,
+			in_progress_tasks, overdue_tasks, avg_completion_time
+		)
+		SELECT
+			time_bucket(make_interval(secs => $1), NOW()),
+			p.id,
+			COUNT(t.id),
+			COUNT(t.id) FILTER (WHERE t.completed_at IS NOT NULL),
+			COUNT(t.id) FILTER (WHERE t.status = 'in_progress'),
+			COUNT(t.id) FILTER (WHERE t.due_date < NOW() AND t.completed_at IS NULL),
+			AVG(EXTRACT(EPOCH FROM (t.completed_at - t.created_at))/3600) FILTER (WHERE t.completed_at IS NOT NULL)
+		FROM projects p
+		LEFT JOIN tasks t ON t.project_id = p.id
+		GROUP BY p.id
+		ON CONFLICT (project_id, timestamp) DO NOTHING
+	`, s.interval.Seconds())
+	return err
+}
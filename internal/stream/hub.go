@@ -0,0 +1,308 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"scalable-task-api/internal/authz"
+	"scalable-task-api/internal/models"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// channel is the NOTIFY channel task events are announced on
+	channel = "task_events"
+	// bufferSize is how many events a subscriber may fall behind by before
+	// it is dropped
+	bufferSize = 256
+	// replayWindow bounds how far back a resuming client is caught up
+	replayWindow = 24 * time.Hour
+	// replayOverlap is how long before the event a client resumes after
+	// replay starts. Event IDs are taken when events are recorded but events
+	// only appear when their transaction commits, so an event may be streamed
+	// before one with a lower ID. Replaying the events recorded shortly
+	// before catches those, as long as transactions recording task events
+	// take less than this. Clients skip events they already have by ID.
+	replayOverlap = time.Minute
+	// replayPage is how many missed events are loaded per query
+	replayPage = 500
+)
+
+// Subscription receives the task events one stream may see. Events is closed
+// when the hub drops the subscription, after which the client should
+// reconnect and resume from the last event it received.
+type Subscription struct {
+	Events <-chan models.TaskEvent
+
+	events   chan models.TaskEvent
+	subject  authz.Subject
+	projects map[int]bool
+}
+
+// wants reports whether the subscription's project filter includes projectID
+func (s *Subscription) wants(projectID int) bool {
+	return s.projects == nil || s.projects[projectID]
+}
+
+// readsAll reports whether the subscriber's global role lets them read every
+// project. The hub's lock must be held, as the subject may be replaced.
+func (s *Subscription) readsAll() bool {
+	return s.subject.Permissions.Access() >= authz.AccessRead
+}
+
+// Hub fans task events out to the streams connected to this replica. Every
+// replica LISTENs for the events recorded by any of them, and checks the
+// subscriber's current access to the event's project before passing it on.
+type Hub struct {
+	db    *sql.DB
+	dsn   string
+	authz *authz.Authorizer
+
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// NewHub creates a new hub. dsn is used for the dedicated LISTEN connection.
+func NewHub(db *sql.DB, dsn string, authorizer *authz.Authorizer) *Hub {
+	return &Hub{
+		db:            db,
+		dsn:           dsn,
+		authz:         authorizer,
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe registers a stream for the subject. With projectIDs, only events
+// of those projects are delivered.
+func (h *Hub) Subscribe(subject authz.Subject, projectIDs []int) *Subscription {
+	events := make(chan models.TaskEvent, bufferSize)
+	sub := &Subscription{Events: events, events: events, subject: subject}
+	if len(projectIDs) > 0 {
+		sub.projects = map[int]bool{}
+		for _, id := range projectIDs {
+			sub.projects[id] = true
+		}
+	}
+
+	h.mu.Lock()
+	h.subscriptions[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Resubscribe replaces the subject a subscription's events are checked
+// against, after their role or permissions changed
+func (h *Hub) Resubscribe(sub *Subscription, subject authz.Subject) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub.subject = subject
+}
+
+// Unsubscribe removes a stream's subscription
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drop(sub)
+}
+
+// drop removes sub and closes its channel. h.mu must be held.
+func (h *Hub) drop(sub *Subscription) {
+	if _, ok := h.subscriptions[sub]; ok {
+		delete(h.subscriptions, sub)
+		close(sub.events)
+	}
+}
+
+// dropAll ends every subscription, so clients reconnect and resume
+func (h *Hub) dropAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscriptions {
+		h.drop(sub)
+	}
+}
+
+// Run listens for task events until ctx is done. Notifications sent while
+// the LISTEN connection is down are lost, so every stream is ended when it
+// reconnects and clients catch up through Last-Event-ID.
+func (h *Hub) Run(ctx context.Context) {
+	listener := pq.NewListener(h.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Task event listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		log.Printf("Failed to listen for task events: %v", err)
+		return
+	}
+	log.Println("Listening for task events")
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.dropAll()
+			log.Println("Task event listener stopped")
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				h.dropAll()
+				continue
+			}
+			if err := h.dispatch(n.Extra); err != nil {
+				log.Printf("Failed to dispatch task event: %v", err)
+			}
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+// dispatch loads the announced event and hands it to every subscription
+// that filters for its project and whose subject can read it. Subscribers
+// that have fallen too far behind are dropped rather than blocking the rest.
+func (h *Hub) dispatch(payload string) error {
+	var note struct {
+		ID         int64     `json:"id"`
+		OccurredAt time.Time `json:"occurred_at"`
+		ProjectID  int       `json:"project_id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &note); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	var targets []*Subscription
+	needReaders := false
+	for sub := range h.subscriptions {
+		if sub.wants(note.ProjectID) {
+			targets = append(targets, sub)
+			needReaders = needReaders || !sub.readsAll()
+		}
+	}
+	h.mu.Unlock()
+	if len(targets) == 0 {
+		return nil
+	}
+
+	events, err := h.loadEvents(`
+		WHERE id = $1 AND occurred_at = $2`, note.ID, note.OccurredAt)
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	event := events[0]
+
+	var readers map[int]bool
+	if needReaders {
+		if readers, err = h.authz.ProjectReaders(event.ProjectID); err != nil {
+			return err
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range targets {
+		if !sub.subject.InScope(event.ProjectID) || !sub.readsAll() && !readers[sub.subject.UserID] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			h.drop(sub)
+		}
+	}
+	return nil
+}
+
+// Replay returns the events after afterID that a subscription would have
+// received, in ID order, along with those recorded within replayOverlap
+// before it, which may have committed after it. Only the last day of events
+// is replayed.
+func (h *Hub) Replay(sub *Subscription, afterID int64) ([]models.TaskEvent, error) {
+	windowStart := time.Now().Add(-replayWindow)
+
+	// Without the event resumed after, only later IDs are replayed
+	var overlapStart *time.Time
+	var resumedAt time.Time
+	err := h.db.QueryRow(`
+		SELECT occurred_at FROM task_events WHERE id = $1 AND occurred_at >= $2
+	`, afterID, windowStart).Scan(&resumedAt)
+	switch {
+	case err == nil:
+		start := resumedAt.Add(-replayOverlap)
+		overlapStart = &start
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	events := []models.TaskEvent{}
+	var cursor int64
+	for {
+		where := `
+			WHERE id > $1 AND id <> $2 AND (id > $2 OR occurred_at >= $3) AND occurred_at >= $4`
+		args := []interface{}{cursor, afterID, overlapStart, windowStart}
+
+		if sub.projects != nil {
+			projectIDs := make([]int64, 0, len(sub.projects))
+			for id := range sub.projects {
+				projectIDs = append(projectIDs, int64(id))
+			}
+			args = append(args, pq.Array(projectIDs))
+			where += ` AND project_id = ANY($` + strconv.Itoa(len(args)) + `)`
+		}
+
+		if condition, conditionArgs := h.authz.VisibleProjectsCondition(sub.subject, "project_id", len(args)+1); condition != "" {
+			where += ` AND ` + condition
+			args = append(args, conditionArgs...)
+		}
+
+		args = append(args, replayPage)
+		where += ` ORDER BY id LIMIT $` + strconv.Itoa(len(args))
+
+		page, err := h.loadEvents(where, args...)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < replayPage {
+			return events, nil
+		}
+		cursor = page[len(page)-1].ID
+	}
+}
+
+// loadEvents reads task events matching the given WHERE clause and what
+// follows it
+func (h *Hub) loadEvents(where string, args ...interface{}) ([]models.TaskEvent, error) {
+	rows, err := h.db.Query(`
+		SELECT id, occurred_at, task_id, project_id, actor_id, event_type, changes
+		FROM task_events`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.TaskEvent
+	for rows.Next() {
+		var event models.TaskEvent
+		var changes []byte
+		err := rows.Scan(
+			&event.ID, &event.OccurredAt, &event.TaskID, &event.ProjectID,
+			&event.ActorID, &event.EventType, &changes,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changes, &event.Changes); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlockedIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"0.0.0.0", true},
+		{"100.64.0.1", true},
+		{"198.18.0.1", true},
+		{"64:ff9b::7f00:1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"93.184.216.34", false},
+		{"2606:4700:4700::1111", false},
+		{"::ffff:93.184.216.34", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if ip == nil {
+				t.Fatalf("invalid test IP %s", tt.ip)
+			}
+			if got := blockedIP(ip); got != tt.blocked {
+				t.Fatalf("blockedIP(%s) = %v, want %v", tt.ip, got, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		blocked      bool
+	}{
+		{"https://example.com/hook", false, false},
+		{"https://93.184.216.34/hook", false, false},
+		{"http://localhost:8080/hook", false, true},
+		{"http://api.localhost/hook", false, true},
+		{"http://LOCALHOST./hook", false, true},
+		{"http://127.0.0.1/hook", false, true},
+		{"http://[::1]/hook", false, true},
+		{"http://[::ffff:127.0.0.1]/hook", false, true},
+		{"http://10.0.0.5/hook", false, true},
+		{"http://100.64.1.1/hook", false, true},
+		{"http://169.254.169.254/latest/meta-data", false, true},
+		{"http://127.0.0.1/hook", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckURL(tt.url, tt.allowPrivate)
+			if tt.blocked && !errors.Is(err, ErrBlockedAddress) {
+				t.Fatalf("CheckURL returned %v, want ErrBlockedAddress", err)
+			}
+			if !tt.blocked && err != nil {
+				t.Fatalf("CheckURL returned %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// The server listens on loopback, which is only reachable when allowed
+	if _, err := newClient(time.Second, false).Get(server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("request to %s returned %v, want ErrBlockedAddress", server.URL, err)
+	}
+
+	resp, err := newClient(time.Second, true).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with private networks allowed failed: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,384 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"scalable-task-api/internal/config"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// batchSize is how many due deliveries one poll claims
+	batchSize = 50
+	// maxBackoff caps the delay between attempts of a delivery
+	maxBackoff = time.Hour
+	// maxDrainedBody bounds how much of a response is read so its connection
+	// can be reused. Response bodies are never stored.
+	maxDrainedBody = 4096
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature header value for a payload sent at timestamp.
+// Receivers recompute the HMAC-SHA256 of "<timestamp>.<body>" with the
+// webhook's secret and compare it with the hex digest after "sha256=".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher sends queued webhook deliveries. Deliveries are claimed in
+// batches by pushing their next attempt past the request timeout, and a batch
+// is sent concurrently so every delivery in it is sent well before its claim
+// expires. Concurrent replicas therefore do not send the same attempt, and a
+// crashed sender's claim simply expires. Outcomes are only recorded while the
+// claim is still held.
+type Dispatcher struct {
+	db           *sql.DB
+	client       *http.Client
+	interval     time.Duration
+	lease        time.Duration
+	retryBase    time.Duration
+	maxAttempts  int
+	disableAfter int
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(db *sql.DB, cfg *config.WebhooksConfig) *Dispatcher {
+	return &Dispatcher{
+		db:           db,
+		client:       newClient(cfg.Timeout, cfg.AllowPrivateNetworks),
+		interval:     cfg.PollInterval,
+		lease:        2 * cfg.Timeout,
+		retryBase:    cfg.RetryBase,
+		maxAttempts:  cfg.MaxAttempts,
+		disableAfter: cfg.DisableAfter,
+	}
+}
+
+// Run sends due deliveries immediately and then once per interval until ctx
+// is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Printf("Starting webhook dispatcher every %s", d.interval)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Dispatch(ctx); err != nil {
+			log.Printf("Webhook dispatch failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type delivery struct {
+	id int64
+	// leasedUntil is the next attempt time set when it was claimed, which
+	// stays unchanged while the claim is held
+	leasedUntil time.Time
+
+	webhookID int
+	eventType string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    string
+}
+
+// Dispatch sends every delivery that is due, batch by batch
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	if err := d.dropUnauthorized(ctx); err != nil {
+		return err
+	}
+	for {
+		deliveries, err := d.claim(ctx)
+		if err != nil {
+			return err
+		}
+		if err := d.sendAll(ctx, deliveries); err != nil {
+			return err
+		}
+		if len(deliveries) < batchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// dropUnauthorized fails the due deliveries of webhooks whose owner may no
+// longer receive the event, such as after losing access to its project or
+// their admin role. They were queued while the owner still had access.
+func (d *Dispatcher) dropUnauthorized(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET status = 'failed', next_attempt_at = NULL, last_error = $1
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.status = 'pending' AND d.next_attempt_at <= NOW() AND w.active
+		  AND NOT webhook_owner_can_receive(w.owner_id, w.project_ids, (d.payload ->> 'project_id')::INTEGER)
+	`, "Webhook owner no longer has access to the event's project")
+	return err
+}
+
+// claim leases a batch of due deliveries to active webhooks
+func (d *Dispatcher) claim(ctx context.Context) ([]delivery, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $1)
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT q.id
+			FROM webhook_deliveries q
+			JOIN webhooks qw ON qw.id = q.webhook_id
+			WHERE q.status = 'pending' AND q.next_attempt_at <= NOW() AND qw.active
+			ORDER BY q.next_attempt_at
+			LIMIT $2
+			FOR UPDATE OF q SKIP LOCKED
+		)
+		RETURNING d.id, d.next_attempt_at, d.webhook_id, d.event_type, d.payload, d.attempts, w.url, w.secret
+	`, d.lease.Seconds(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []delivery
+	for rows.Next() {
+		var delivery delivery
+		if err := rows.Scan(&delivery.id, &delivery.leasedUntil, &delivery.webhookID, &delivery.eventType, &delivery.payload,
+			&delivery.attempts, &delivery.url, &delivery.secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// sendAll sends a claimed batch concurrently, returning the first failure to
+// record an outcome
+func (d *Dispatcher) sendAll(ctx context.Context, deliveries []delivery) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for i := range deliveries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := d.send(ctx, deliveries[i]); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// send makes one attempt at a delivery and records its outcome. Only
+// failures to record the outcome are returned.
+func (d *Dispatcher) send(ctx context.Context, delivery delivery) error {
+	status, attemptErr := d.post(ctx, delivery)
+
+	var lastError *string
+	if attemptErr != nil {
+		message := attemptErr.Error()
+		lastError = &message
+	}
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+
+	attempts := delivery.attempts + 1
+	if attemptErr == nil {
+		return d.recordSuccess(ctx, delivery, attempts, responseStatus)
+	}
+	return d.recordFailure(ctx, delivery, attempts, responseStatus, lastError)
+}
+
+// post sends the delivery and returns the response status. Any status other
+// than 2xx is an error. Errors are fixed descriptions, since webhook owners
+// read them back and must not learn anything about the network beyond what
+// the endpoint's status tells them.
+func (d *Dispatcher) post(ctx context.Context, delivery delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.url, bytes.NewReader(delivery.payload))
+	if err != nil {
+		return 0, errors.New("webhook URL is invalid")
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "scalable-task-api-webhooks")
+	req.Header.Set(HeaderEvent, delivery.eventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.id, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.secret, timestamp, delivery.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, requestError(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainedBody))
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode <= 399:
+		return resp.StatusCode, fmt.Errorf("endpoint responded %d; redirects are not followed", resp.StatusCode)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return resp.StatusCode, fmt.Errorf("endpoint responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// requestError describes why a request could not be sent without revealing
+// details of the network
+func requestError(err error) error {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrBlockedAddress):
+		return ErrBlockedAddress
+	case errors.As(err, &dnsErr):
+		return errors.New("webhook host could not be resolved")
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return errors.New("webhook request timed out")
+	}
+	return errors.New("webhook request failed")
+}
+
+// recordSuccess marks the delivery as sent
+func (d *Dispatcher) recordSuccess(ctx context.Context, delivery delivery, attempts int, responseStatus *int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = 'succeeded', attempts = $3, next_attempt_at = NULL, last_attempt_at = NOW(),
+			response_status = $4, last_error = NULL
+		WHERE id = $1 AND status = 'pending' AND next_attempt_at = $2
+	`, delivery.id, delivery.leasedUntil, attempts, responseStatus)
+	if held, err := leaseHeld(delivery, result, err); !held {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1 AND consecutive_failures > 0
+	`, delivery.webhookID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordFailure schedules the next attempt with exponential backoff, or fails
+// the delivery once its attempts are used up. A webhook whose attempts keep
+// failing is disabled.
+func (d *Dispatcher) recordFailure(ctx context.Context, delivery delivery, attempts int, responseStatus *int, lastError *string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status := "pending"
+	var nextAttemptAt *time.Time
+	if attempts >= d.maxAttempts {
+		status = "failed"
+	} else {
+		next := time.Now().Add(d.backoff(attempts))
+		nextAttemptAt = &next
+	}
+
+	result, err := tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $3, attempts = $4, next_attempt_at = $5, last_attempt_at = NOW(),
+			response_status = $6, last_error = $7
+		WHERE id = $1 AND status = 'pending' AND next_attempt_at = $2
+	`, delivery.id, delivery.leasedUntil, status, attempts, nextAttemptAt, responseStatus, lastError)
+	if held, err := leaseHeld(delivery, result, err); !held {
+		return err
+	}
+
+	var disabled bool
+	err = tx.QueryRow(`
+		UPDATE webhooks
+		SET consecutive_failures = consecutive_failures + 1,
+			active = active AND consecutive_failures + 1 < $2,
+			disabled_at = CASE WHEN active AND consecutive_failures + 1 >= $2 THEN NOW() ELSE disabled_at END,
+			disabled_reason = CASE WHEN active AND consecutive_failures + 1 >= $2 THEN $3 ELSE disabled_reason END,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING disabled_at IS NOT NULL AND NOT active AND consecutive_failures = $2
+	`, delivery.webhookID, d.disableAfter, fmt.Sprintf("Disabled after %d consecutive failed deliveries", d.disableAfter)).Scan(&disabled)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if disabled {
+		log.Printf("Disabled webhook %d after %d consecutive failed deliveries", delivery.webhookID, d.disableAfter)
+	}
+
+	return tx.Commit()
+}
+
+// leaseHeld reports whether recording a delivery's outcome updated it. If
+// not, its claim expired and another sender took it over, so the outcome is
+// dropped rather than counted twice.
+func leaseHeld(delivery delivery, result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		log.Printf("Claim on webhook delivery %d expired before its outcome was recorded", delivery.id)
+		return false, nil
+	}
+	return true, nil
+}
+
+// backoff returns the delay before the attempt after the given number of
+// failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.retryBase
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,34 @@
+package webhook
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{
+			name:      "HMAC-SHA256 of timestamp and body",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			body:      `{"event":"task.created"}`,
+			want:      "sha256=aabc548901ea3b50be05eb85dc114164830b27c602dcb16a1623b007eff48c20",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Fatalf("Sign = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// The timestamp is signed, so a replayed body with a new timestamp fails
+	if Sign("whsec_test", 1700000001, []byte(`{"event":"task.created"}`)) == tests[0].want {
+		t.Fatal("signature does not depend on the timestamp")
+	}
+}
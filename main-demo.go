@@ -77,7 +77,10 @@ func runDemoMode() {
 	}
 
 	// Initialize services
-	jwtService := auth.NewJWTService(&cfg.JWT)
+	jwtService, err := auth.NewJWTService(&cfg.JWT)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT service: %v", err)
+	}
 
 	// Set up Gin in demo mode
 	gin.SetMode(gin.ReleaseMode)
@@ -143,8 +146,10 @@ func setupDemoRoutes(router *gin.Engine, jwtService *auth.JWTService) {
 
 			// Demo login - accept testuser/password123
 			if req.Username == "testuser" && req.Password == "password123" {
-				accessToken, _ := jwtService.GenerateToken(1, "testuser", "admin")
-				refreshToken, _ := jwtService.GenerateRefreshToken(1, "testuser", "admin")
+				// Refresh tokens are opaque and kept in the database, which
+				// the demo does not have, so it hands out a placeholder
+				accessToken, _ := jwtService.GenerateToken(1, "testuser", "admin", "demo-session")
+				refreshToken := "demo-refresh-token"
 
 				c.JSON(http.StatusOK, auth.TokenResponse{
 					AccessToken:  accessToken,
@@ -29,7 +29,10 @@ func main() {
 	}
 
 	// Initialize and start API server
-	server := api.NewServer(cfg, db)
+	server, err := api.NewServer(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
 	if err := server.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}